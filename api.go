@@ -0,0 +1,610 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/labstack/echo/v4"
+	"github.com/quiq/registry-ui/events"
+	"github.com/quiq/registry-ui/registry"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+type apiRegistry struct {
+	Name              string            `json:"name"`
+	Hostname          string            `json:"hostname"`
+	TagsCountProgress registry.Progress `json:"tagsCountProgress"`
+}
+
+type apiRepo struct {
+	Name     string `json:"name"`
+	Path     string `json:"path"`
+	TagCount int    `json:"tagCount"`
+}
+
+type apiCatalog struct {
+	Registry       string    `json:"registry"`
+	RepoPath       string    `json:"repoPath"`
+	IsCatalogReady bool      `json:"isCatalogReady"`
+	IsRepo         bool      `json:"isRepo"`
+	Repos          []apiRepo `json:"repos"`
+}
+
+type apiTags struct {
+	Registry string   `json:"registry"`
+	RepoPath string   `json:"repoPath"`
+	TagCount int      `json:"tagCount"`
+	Tags     []string `json:"tags"`
+}
+
+type apiTagDetails struct {
+	registry.TagDetails
+	Error string `json:"error,omitempty"`
+}
+
+type apiTagAliases struct {
+	Digest string   `json:"digest"`
+	Tags   []string `json:"tags"`
+}
+
+type apiSBOM struct {
+	Artifact string `json:"artifact"`
+	registry.SBOM
+}
+
+type apiFileChanges struct {
+	Files     []registry.FileChange `json:"files"`
+	Truncated bool                  `json:"truncated"`
+}
+
+type apiEvents struct {
+	Registry string            `json:"registry"`
+	RepoPath string            `json:"repoPath"`
+	Events   []events.EventRow `json:"events"`
+}
+
+type apiMessage struct {
+	Message string `json:"message,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// apiError reply with JSON error body.
+func apiError(c echo.Context, code int, msg string) error {
+	return c.JSON(code, apiMessage{Error: msg})
+}
+
+// apiRegistryError reply with JSON error body and the status code according to the registry error.
+func apiRegistryError(c echo.Context, err error) error {
+	code := http.StatusBadGateway
+	switch {
+	case errors.Is(err, registry.ErrNotFound):
+		code = http.StatusNotFound
+	case errors.Is(err, registry.ErrUnauthorized):
+		code = http.StatusForbidden
+	case errors.Is(err, registry.ErrRateLimited):
+		code = http.StatusTooManyRequests
+	case errors.Is(err, context.DeadlineExceeded):
+		code = http.StatusGatewayTimeout
+	}
+	return apiError(c, code, err.Error())
+}
+
+// apiRegistries list configured registries, the first one is the default.
+func (a *apiClient) apiRegistries(c echo.Context) error {
+	res := []apiRegistry{}
+	for _, client := range a.clients {
+		res = append(res, apiRegistry{Name: client.Name(), Hostname: client.Hostname(), TagsCountProgress: client.TagsCountProgress()})
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+// apiCatalog list sub-repos of the repo path with their tag counts, the whole catalog at the root.
+func (a *apiClient) apiCatalog(c echo.Context) error {
+	repoPath := strings.Trim(c.Param("repoPath"), "/")
+	client := a.getClientByName(c.QueryParam("registry"))
+	if client == nil {
+		return apiError(c, http.StatusNotFound, "unknown registry: "+c.QueryParam("registry"))
+	}
+	repos, isRepo := listRepos(client, repoPath)
+	if repoPath != "" && !isRepo && len(repos) == 0 {
+		return apiError(c, http.StatusNotFound, "repository not found: "+repoPath)
+	}
+
+	tagCounts := client.SubRepoTagCounts(repoPath, repos)
+	res := apiCatalog{
+		Registry:       client.Name(),
+		RepoPath:       repoPath,
+		IsCatalogReady: client.IsCatalogReady(),
+		IsRepo:         isRepo,
+		Repos:          []apiRepo{},
+	}
+	for _, r := range repos {
+		fullRepoPath := r
+		if repoPath != "" {
+			fullRepoPath = repoPath + "/" + r
+		}
+		res.Repos = append(res.Repos, apiRepo{Name: r, Path: fullRepoPath, TagCount: tagCounts[fullRepoPath]})
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+// apiTags list tags of the repo.
+func (a *apiClient) apiTags(c echo.Context) error {
+	repoPath := strings.Trim(c.Param("repoPath"), "/")
+	client := a.getClientByName(c.QueryParam("registry"))
+	if client == nil {
+		return apiError(c, http.StatusNotFound, "unknown registry: "+c.QueryParam("registry"))
+	}
+	if _, isRepo := listRepos(client, repoPath); !isRepo {
+		return apiError(c, http.StatusNotFound, "repository not found: "+repoPath)
+	}
+
+	tags, err := client.ListTags(c.Request().Context(), repoPath)
+	if err != nil {
+		return apiRegistryError(c, err)
+	}
+	return c.JSON(http.StatusOK, apiTags{Registry: client.Name(), RepoPath: repoPath, TagCount: len(tags), Tags: tags})
+}
+
+// maxTagDetailsBatch max number of tags to get details of in a single request.
+const maxTagDetailsBatch = 100
+
+// apiTagDetails get digest, created time, size and platforms of the tags passed as "tag" query params.
+func (a *apiClient) apiTagDetails(c echo.Context) error {
+	repoPath := strings.Trim(c.Param("repoPath"), "/")
+	tags := c.QueryParams()["tag"]
+	if len(tags) == 0 || len(tags) > maxTagDetailsBatch {
+		return apiError(c, http.StatusBadRequest, fmt.Sprintf("from 1 to %d tag parameters are required", maxTagDetailsBatch))
+	}
+	client := a.getClientByName(c.QueryParam("registry"))
+	if client == nil {
+		return apiError(c, http.StatusNotFound, "unknown registry: "+c.QueryParam("registry"))
+	}
+	if _, isRepo := listRepos(client, repoPath); !isRepo {
+		return apiError(c, http.StatusNotFound, "repository not found: "+repoPath)
+	}
+
+	details, errs := client.GetTagsDetails(c.Request().Context(), repoPath, tags)
+	res := []apiTagDetails{}
+	for i, d := range details {
+		item := apiTagDetails{TagDetails: d}
+		if errs[i] != nil {
+			item.Tag = tags[i]
+			item.Error = errs[i].Error()
+		}
+		res = append(res, item)
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+// apiTagAliases list the tags pointing to the same digest as the tag, they are deleted together.
+func (a *apiClient) apiTagAliases(c echo.Context) error {
+	repoPath := strings.Trim(c.Param("repoPath"), "/")
+	tag := c.QueryParam("tag")
+	if tag == "" {
+		return apiError(c, http.StatusBadRequest, "tag parameter is required")
+	}
+	client := a.getClientByName(c.QueryParam("registry"))
+	if client == nil {
+		return apiError(c, http.StatusNotFound, "unknown registry: "+c.QueryParam("registry"))
+	}
+	if _, isRepo := listRepos(client, repoPath); !isRepo {
+		return apiError(c, http.StatusNotFound, "repository not found: "+repoPath)
+	}
+
+	digest, tags, err := client.GetTagAliases(c.Request().Context(), repoPath, tag)
+	if err != nil {
+		return apiRegistryError(c, err)
+	}
+	return c.JSON(http.StatusOK, apiTagAliases{Digest: digest, Tags: tags})
+}
+
+// apiImageInfo show image info by the reference "repo:tag" or "repo@sha256:...".
+func (a *apiClient) apiImageInfo(c echo.Context) error {
+	imageRef := strings.Trim(c.Param("imageRef"), "/")
+	if !strings.Contains(imageRef, ":") {
+		return apiError(c, http.StatusBadRequest, "image reference should be in the format repo:tag or repo@digest")
+	}
+
+	client := a.getClientByName(c.QueryParam("registry"))
+	if client == nil {
+		return apiError(c, http.StatusNotFound, "unknown registry: "+c.QueryParam("registry"))
+	}
+	imageInfo, err := client.GetImageInfo(c.Request().Context(), imageRef)
+	if err != nil {
+		return apiRegistryError(c, err)
+	}
+	return c.JSON(http.StatusOK, imageInfo)
+}
+
+// apiLayerFiles list files of the layer blob by "digest" query param.
+func (a *apiClient) apiLayerFiles(c echo.Context) error {
+	repoPath := strings.Trim(c.Param("repoPath"), "/")
+	digest := c.QueryParam("digest")
+	if _, err := v1.NewHash(digest); err != nil {
+		return apiError(c, http.StatusBadRequest, "digest parameter is invalid: "+err.Error())
+	}
+	client := a.getClientByName(c.QueryParam("registry"))
+	if client == nil {
+		return apiError(c, http.StatusNotFound, "unknown registry: "+c.QueryParam("registry"))
+	}
+	if _, isRepo := listRepos(client, repoPath); !isRepo {
+		return apiError(c, http.StatusNotFound, "repository not found: "+repoPath)
+	}
+
+	files, err := client.ListLayerFiles(c.Request().Context(), repoPath, digest, viper.GetInt("performance.layer_files_limit"))
+	if err != nil {
+		return apiRegistryError(c, err)
+	}
+	return c.JSON(http.StatusOK, files)
+}
+
+// apiReferrers list signatures, SBOMs, attestations and other artifacts attached to the image digest.
+func (a *apiClient) apiReferrers(c echo.Context) error {
+	repoPath := strings.Trim(c.Param("repoPath"), "/")
+	digest := c.QueryParam("digest")
+	if _, err := v1.NewHash(digest); err != nil {
+		return apiError(c, http.StatusBadRequest, "digest parameter is invalid: "+err.Error())
+	}
+	client := a.getClientByName(c.QueryParam("registry"))
+	if client == nil {
+		return apiError(c, http.StatusNotFound, "unknown registry: "+c.QueryParam("registry"))
+	}
+	if _, isRepo := listRepos(client, repoPath); !isRepo {
+		return apiError(c, http.StatusNotFound, "repository not found: "+repoPath)
+	}
+
+	referrers, err := client.ListReferrers(c.Request().Context(), repoPath, digest)
+	if err != nil {
+		return apiRegistryError(c, err)
+	}
+	return c.JSON(http.StatusOK, referrers)
+}
+
+// apiSBOM get packages of the SBOM attached to the image "digest" as JSON or CSV with "format=csv".
+// The first SBOM is returned unless "artifact" digest is set.
+func (a *apiClient) apiSBOM(c echo.Context) error {
+	repoPath := strings.Trim(c.Param("repoPath"), "/")
+	digest := c.QueryParam("digest")
+	artifact := c.QueryParam("artifact")
+	if _, err := v1.NewHash(digest); err != nil {
+		return apiError(c, http.StatusBadRequest, "digest parameter is invalid: "+err.Error())
+	}
+	if artifact != "" {
+		if _, err := v1.NewHash(artifact); err != nil {
+			return apiError(c, http.StatusBadRequest, "artifact parameter is invalid: "+err.Error())
+		}
+	}
+	client := a.getClientByName(c.QueryParam("registry"))
+	if client == nil {
+		return apiError(c, http.StatusNotFound, "unknown registry: "+c.QueryParam("registry"))
+	}
+	if _, isRepo := listRepos(client, repoPath); !isRepo {
+		return apiError(c, http.StatusNotFound, "repository not found: "+repoPath)
+	}
+
+	artifact, sbom, err := client.FindSBOM(c.Request().Context(), repoPath, digest, artifact)
+	if err != nil {
+		return apiRegistryError(c, err)
+	}
+
+	if c.QueryParam("format") == "csv" {
+		c.Response().Header().Set(echo.HeaderContentType, "text/csv; charset=utf-8")
+		c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", "sbom-"+strings.TrimPrefix(digest, "sha256:")[:12]+".csv"))
+		c.Response().WriteHeader(http.StatusOK)
+		w := csv.NewWriter(c.Response())
+		w.Write([]string{"name", "version", "license", "purl"})
+		for _, p := range sbom.Packages {
+			w.Write([]string{p.Name, p.Version, p.License, p.PURL})
+		}
+		w.Flush()
+		return w.Error()
+	}
+	return c.JSON(http.StatusOK, apiSBOM{Artifact: artifact, SBOM: sbom})
+}
+
+// apiExport stream the image as OCI image layout or docker tarball, admins only.
+// The format is set by "format" query param, "oci" by default, "platform" picks a single image of the index.
+func (a *apiClient) apiExport(c echo.Context) error {
+	imageRef := strings.Trim(c.Param("imageRef"), "/")
+	if !strings.Contains(imageRef, ":") {
+		return apiError(c, http.StatusBadRequest, "image reference should be in the format repo:tag or repo@digest")
+	}
+	format := c.QueryParam("format")
+	if format == "" {
+		format = registry.ExportOCI
+	}
+	if format != registry.ExportOCI && format != registry.ExportDocker {
+		return apiError(c, http.StatusBadRequest, "format parameter should be oci or docker")
+	}
+
+	data := a.setUserPermissions(c)
+	if !data["isAdmin"].Bool() {
+		return apiError(c, http.StatusForbidden, "user is not permitted to export images")
+	}
+	client := a.getClientByName(c.QueryParam("registry"))
+	if client == nil {
+		return apiError(c, http.StatusNotFound, "unknown registry: "+c.QueryParam("registry"))
+	}
+
+	export, err := client.NewExport(c.Request().Context(), imageRef, format, c.QueryParam("platform"))
+	if errors.Is(err, registry.ErrPlatformRequired) {
+		return apiError(c, http.StatusBadRequest, err.Error())
+	} else if err != nil {
+		return apiRegistryError(c, err)
+	}
+
+	c.Response().Header().Set(echo.HeaderContentType, "application/x-tar")
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", export.Filename))
+	c.Response().WriteHeader(http.StatusOK)
+	if err := export.Write(c.Response()); err != nil {
+		// The response is already started, so the client gets a truncated tarball.
+		logrus.Errorf("Error exporting %s: %s", imageRef, err)
+	}
+	return nil
+}
+
+// searchResultsLimit max number of repos, tags and labels each returned by search.
+const searchResultsLimit = 500
+
+// apiSearch search repos, tags and cached image labels containing the query "q".
+func (a *apiClient) apiSearch(c echo.Context) error {
+	q := strings.TrimSpace(c.QueryParam("q"))
+	if q == "" {
+		return apiError(c, http.StatusBadRequest, "q parameter is required")
+	}
+	client := a.getClientByName(c.QueryParam("registry"))
+	if client == nil {
+		return apiError(c, http.StatusNotFound, "unknown registry: "+c.QueryParam("registry"))
+	}
+	return c.JSON(http.StatusOK, client.Search(q, searchResultsLimit))
+}
+
+// apiCompare compare two images of the repo set by "base" and "target" tags or digests.
+func (a *apiClient) apiCompare(c echo.Context) error {
+	repoPath := strings.Trim(c.Param("repoPath"), "/")
+	client, diff, err := a.compareImages(c, repoPath)
+	if err != nil || client == nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, diff)
+}
+
+// apiCompareFiles compare files of the layers which are not shared by two images.
+func (a *apiClient) apiCompareFiles(c echo.Context) error {
+	repoPath := strings.Trim(c.Param("repoPath"), "/")
+	client, diff, err := a.compareImages(c, repoPath)
+	if err != nil || client == nil {
+		return err
+	}
+	files, truncated, err := client.CompareLayerFiles(c.Request().Context(), repoPath, diff, viper.GetInt("performance.layer_files_limit"))
+	if err != nil {
+		return apiRegistryError(c, err)
+	}
+	return c.JSON(http.StatusOK, apiFileChanges{Files: files, Truncated: truncated})
+}
+
+// compareImages compare images for API calls, the client is nil when the error reply has been sent.
+func (a *apiClient) compareImages(c echo.Context, repoPath string) (*registry.Client, registry.ImageDiff, error) {
+	base := c.QueryParam("base")
+	target := c.QueryParam("target")
+	if base == "" || target == "" {
+		return nil, registry.ImageDiff{}, apiError(c, http.StatusBadRequest, "base and target parameters are required")
+	}
+	client := a.getClientByName(c.QueryParam("registry"))
+	if client == nil {
+		return nil, registry.ImageDiff{}, apiError(c, http.StatusNotFound, "unknown registry: "+c.QueryParam("registry"))
+	}
+	diff, err := client.CompareImages(c.Request().Context(), repoPath, base, target)
+	if err != nil {
+		return nil, registry.ImageDiff{}, apiRegistryError(c, err)
+	}
+	return client, diff, nil
+}
+
+// apiDeleteTag delete the tag of the repo, with "untag=true" the other tags of the same image are kept.
+func (a *apiClient) apiDeleteTag(c echo.Context) error {
+	repoPath := strings.Trim(c.Param("repoPath"), "/")
+	tag := c.QueryParam("tag")
+	if tag == "" {
+		return apiError(c, http.StatusBadRequest, "tag parameter is required")
+	}
+
+	data := a.setUserPermissions(c)
+	if !data["deleteAllowed"].Bool() {
+		return apiError(c, http.StatusForbidden, "user is not permitted to delete tags")
+	}
+	client := a.getClientByName(c.QueryParam("registry"))
+	if client == nil {
+		return apiError(c, http.StatusNotFound, "unknown registry: "+c.QueryParam("registry"))
+	}
+	if c.QueryParam("untag") == "true" {
+		// Safe untag, keep the other tags pointing to the same image.
+		method, err := client.UntagTag(c.Request().Context(), repoPath, tag)
+		if err != nil {
+			return apiRegistryError(c, err)
+		}
+		return c.JSON(http.StatusOK, apiMessage{Message: "deleted " + repoPath + ":" + tag + " by " + string(method)})
+	}
+	if err := client.DeleteTag(c.Request().Context(), repoPath, tag); err != nil {
+		return apiRegistryError(c, err)
+	}
+	return c.JSON(http.StatusOK, apiMessage{Message: "deleted " + repoPath + ":" + tag})
+}
+
+// apiCopyImage tag the "source" image reference as "tag" of the repo, admins only.
+// The source is repo:tag or repo@digest of the same or another repo, the blobs are copied then.
+func (a *apiClient) apiCopyImage(c echo.Context) error {
+	repoPath := strings.Trim(c.Param("repoPath"), "/")
+	tag := c.QueryParam("tag")
+	source := strings.Trim(c.QueryParam("source"), "/")
+	if tag == "" {
+		return apiError(c, http.StatusBadRequest, "tag parameter is required")
+	}
+	if !strings.Contains(source, ":") {
+		return apiError(c, http.StatusBadRequest, "source parameter should be in the format repo:tag or repo@digest")
+	}
+	if _, err := name.NewTag(repoPath + ":" + tag); err != nil {
+		return apiError(c, http.StatusBadRequest, "tag parameter is invalid: "+err.Error())
+	}
+
+	data := a.setUserPermissions(c)
+	if !data["isAdmin"].Bool() {
+		return apiError(c, http.StatusForbidden, "user is not permitted to tag images")
+	}
+	client := a.getClientByName(c.QueryParam("registry"))
+	if client == nil {
+		return apiError(c, http.StatusNotFound, "unknown registry: "+c.QueryParam("registry"))
+	}
+	digest, err := client.CopyImage(c.Request().Context(), source, repoPath, tag, c.QueryParam("overwrite") == "true")
+	if errors.Is(err, registry.ErrTagExists) {
+		return apiError(c, http.StatusConflict, err.Error())
+	} else if err != nil {
+		return apiRegistryError(c, err)
+	}
+	return c.JSON(http.StatusOK, apiMessage{Message: "tagged " + source + " as " + repoPath + ":" + tag + " (" + digest + ")"})
+}
+
+// apiRefresh trigger refresh of the catalog and tag counts of the registry, admins only.
+func (a *apiClient) apiRefresh(c echo.Context) error {
+	data := a.setUserPermissions(c)
+	if !data["isAdmin"].Bool() {
+		return apiError(c, http.StatusForbidden, "user is not permitted to refresh the catalog")
+	}
+	client := a.getClientByName(c.QueryParam("registry"))
+	if client == nil {
+		return apiError(c, http.StatusNotFound, "unknown registry: "+c.QueryParam("registry"))
+	}
+	if !client.Refresh() {
+		return apiError(c, http.StatusConflict, "refresh or tags counting is already running")
+	}
+	return c.JSON(http.StatusAccepted, apiMessage{Message: "refresh started"})
+}
+
+// apiEvents list events of the registry, optionally filtered by the repo path.
+func (a *apiClient) apiEvents(c echo.Context) error {
+	repoPath := strings.Trim(c.QueryParam("repoPath"), "/")
+	data := a.setUserPermissions(c)
+	if !data["eventsAllowed"].Bool() {
+		return apiError(c, http.StatusForbidden, "user is not permitted to view events")
+	}
+	client := a.getClientByName(c.QueryParam("registry"))
+	if client == nil {
+		return apiError(c, http.StatusNotFound, "unknown registry: "+c.QueryParam("registry"))
+	}
+
+	rows := a.eventListener.GetEvents(client.Name(), repoPath)
+	if rows == nil {
+		rows = []events.EventRow{}
+	}
+	return c.JSON(http.StatusOK, apiEvents{Registry: client.Name(), RepoPath: repoPath, Events: rows})
+}
+
+// apiPromote promote the image to another registry by "target" name with all its referrers, admins only.
+// The image is tagged with "tag" param on the target registry, it defaults to the source tag.
+func (a *apiClient) apiPromote(c echo.Context) error {
+	imageRef := strings.Trim(c.Param("imageRef"), "/")
+	if !strings.Contains(imageRef, ":") {
+		return apiError(c, http.StatusBadRequest, "image reference should be in the format repo:tag or repo@digest")
+	}
+	if c.QueryParam("target") == "" {
+		return apiError(c, http.StatusBadRequest, "target parameter is required")
+	}
+
+	data := a.setUserPermissions(c)
+	if !data["isAdmin"].Bool() {
+		return apiError(c, http.StatusForbidden, "user is not permitted to promote images")
+	}
+	client := a.getClientByName(c.QueryParam("registry"))
+	if client == nil {
+		return apiError(c, http.StatusNotFound, "unknown registry: "+c.QueryParam("registry"))
+	}
+	res, err := a.promoteImage(c.Request().Context(), client, c.QueryParam("target"), imageRef, c.QueryParam("tag"), data["user"].String())
+	if err != nil {
+		return apiRegistryError(c, err)
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+// apiPromotions list promotions, optionally filtered by the repo path.
+func (a *apiClient) apiPromotions(c echo.Context) error {
+	data := a.setUserPermissions(c)
+	if !data["eventsAllowed"].Bool() {
+		return apiError(c, http.StatusForbidden, "user is not permitted to view events")
+	}
+	return c.JSON(http.StatusOK, a.eventListener.GetPromotions(strings.Trim(c.QueryParam("repoPath"), "/")))
+}
+
+// importContentTypes content types of the import request body, they are not allowed for cross-origin requests without CORS.
+var importContentTypes = []string{"application/x-tar", "application/gzip", "application/octet-stream"}
+
+// apiImport push docker or OCI image layout tarball from the request body to "repo" and "tag" in background, admins only.
+// The progress is reported by apiImportStatus.
+func (a *apiClient) apiImport(c echo.Context) error {
+	repo := strings.Trim(c.QueryParam("repo"), "/")
+	tag := c.QueryParam("tag")
+	if repo == "" || tag == "" {
+		return apiError(c, http.StatusBadRequest, "repo and tag parameters are required")
+	}
+	if _, err := name.NewTag(repo + ":" + tag); err != nil {
+		return apiError(c, http.StatusBadRequest, "repo or tag parameter is invalid: "+err.Error())
+	}
+	contentType, _, _ := strings.Cut(c.Request().Header.Get(echo.HeaderContentType), ";")
+	if !registry.ItemInSlice(strings.TrimSpace(contentType), importContentTypes) {
+		return apiError(c, http.StatusUnsupportedMediaType, "content type should be one of "+strings.Join(importContentTypes, ", "))
+	}
+
+	data := a.setUserPermissions(c)
+	if !data["isAdmin"].Bool() {
+		return apiError(c, http.StatusForbidden, "user is not permitted to import images")
+	}
+	client := a.getClientByName(c.QueryParam("registry"))
+	if client == nil {
+		return apiError(c, http.StatusNotFound, "unknown registry: "+c.QueryParam("registry"))
+	}
+
+	tarPath, err := registry.SaveUpload(c.Request().Body, int64(viper.GetInt("performance.import_size_limit_mb"))<<20)
+	if errors.Is(err, registry.ErrInvalidTarball) {
+		return apiError(c, http.StatusBadRequest, err.Error())
+	} else if errors.Is(err, registry.ErrUploadTooLarge) {
+		return apiError(c, http.StatusRequestEntityTooLarge, err.Error())
+	} else if err != nil {
+		return apiError(c, http.StatusInternalServerError, "cannot save the upload: "+err.Error())
+	}
+	job, err := client.StartImport(tarPath, repo, tag)
+	if errors.Is(err, registry.ErrInvalidTarball) {
+		return apiError(c, http.StatusBadRequest, err.Error())
+	} else if err != nil {
+		return apiRegistryError(c, err)
+	}
+	return c.JSON(http.StatusAccepted, job)
+}
+
+// apiImportStatus get the progress of the import started by apiImport, admins only.
+func (a *apiClient) apiImportStatus(c echo.Context) error {
+	data := a.setUserPermissions(c)
+	if !data["isAdmin"].Bool() {
+		return apiError(c, http.StatusForbidden, "user is not permitted to import images")
+	}
+	client := a.getClientByName(c.QueryParam("registry"))
+	if client == nil {
+		return apiError(c, http.StatusNotFound, "unknown registry: "+c.QueryParam("registry"))
+	}
+	job, ok := client.GetImport(c.Param("id"))
+	if !ok {
+		return apiError(c, http.StatusNotFound, "import not found: "+c.Param("id"))
+	}
+	return c.JSON(http.StatusOK, job)
+}
+
+// apiNotFound reply with JSON error for unknown API routes.
+func (a *apiClient) apiNotFound(c echo.Context) error {
+	return apiError(c, http.StatusNotFound, "unknown API endpoint")
+}
@@ -6,8 +6,8 @@ import (
 	"fmt"
 	"net"
 	"net/http"
-	"os"
 	"strings"
+	"sync"
 
 	"github.com/quiq/registry-ui/registry"
 	"github.com/sirupsen/logrus"
@@ -24,6 +24,7 @@ const (
 	schemaSQLite = `
 	CREATE TABLE events (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		registry VARCHAR(100) NULL,
 		action CHAR(5) NULL,
 		repository VARCHAR(100) NULL,
 		tag VARCHAR(100) NULL,
@@ -41,6 +42,10 @@ type EventListener struct {
 	retention        int
 	eventDeletion    bool
 	logger           *logrus.Entry
+	// defaultRegistry name of the registry the events stored before the registry column was added belong to.
+	defaultRegistry string
+	schemaMux       sync.Mutex
+	schemaReady     bool
 }
 
 type eventData struct {
@@ -49,17 +54,19 @@ type eventData struct {
 
 // EventRow event row from sqlite
 type EventRow struct {
-	ID         int
-	Action     string
-	Repository string
-	Tag        string
-	IP         string
-	User       string
-	Created    string
+	ID         int    `json:"id"`
+	Registry   string `json:"registry"`
+	Action     string `json:"action"`
+	Repository string `json:"repository"`
+	Tag        string `json:"tag"`
+	IP         string `json:"ip"`
+	User       string `json:"user"`
+	Created    string `json:"created"`
 }
 
 // NewEventListener initialize EventListener.
-func NewEventListener() *EventListener {
+// Events are stored per registry, the ones stored by older versions are assigned to the default registry.
+func NewEventListener(defaultRegistry string) *EventListener {
 	databaseDriver := viper.GetString("event_listener.database_driver")
 	databaseLocation := viper.GetString("event_listener.database_location")
 	retention := viper.GetInt("event_listener.retention_days")
@@ -75,32 +82,24 @@ func NewEventListener() *EventListener {
 		retention:        retention,
 		eventDeletion:    eventDeletion,
 		logger:           registry.SetupLogging("events.event_listener"),
+		defaultRegistry:  defaultRegistry,
 	}
 }
 
-// ProcessEvents parse and store registry events
-func (e *EventListener) ProcessEvents(request *http.Request) {
+// ProcessEvents parse and store events of the registry.
+// Return manifest events, i.e. ones changing the list of tags, so the catalog can be updated accordingly.
+func (e *EventListener) ProcessEvents(registryName string, request *http.Request) []EventRow {
 	decoder := json.NewDecoder(request.Body)
 	var t eventData
 	if err := decoder.Decode(&t); err != nil {
 		e.logger.Errorf("Problem decoding event from request: %+v", request)
-		return
+		return nil
 	}
 	e.logger.Debugf("Received event: %+v", t)
 	j, _ := json.Marshal(t)
 
-	db, err := e.getDatabaseHandler()
-	if err != nil {
-		e.logger.Error(err)
-		return
-	}
-	defer db.Close()
-
-	now := "DateTime('now')"
-	if e.databaseDriver == "mysql" {
-		now = "NOW()"
-	}
-	stmt, _ := db.Prepare("INSERT INTO events(action, repository, tag, ip, user, created) values(?,?,?,?,?," + now + ")")
+	events := []EventRow{}
+	manifestEvents := []EventRow{}
 	for _, i := range gjson.GetBytes(j, "events").Array() {
 		// Ignore calls by registry-ui itself.
 		if strings.HasPrefix(i.Get("request.useragent").String(), userAgent) {
@@ -120,10 +119,30 @@ func (e *EventListener) ProcessEvents(request *http.Request) {
 		user := i.Get("actor.name").String()
 		e.logger.Debugf("Parsed event data: %s %s:%s %s %s ", action, repository, tag, ip, user)
 
-		res, err := stmt.Exec(action, repository, tag, ip, user)
+		row := EventRow{Registry: registryName, Action: action, Repository: repository, Tag: tag, IP: ip, User: user}
+		events = append(events, row)
+		if isManifestEvent(i.Get("target.mediaType").String()) {
+			manifestEvents = append(manifestEvents, row)
+		}
+	}
+
+	db, err := e.getDatabaseHandler()
+	if err != nil {
+		e.logger.Error(err)
+		return manifestEvents
+	}
+	defer db.Close()
+
+	now := "DateTime('now')"
+	if e.databaseDriver == "mysql" {
+		now = "NOW()"
+	}
+	stmt, _ := db.Prepare("INSERT INTO events(registry, action, repository, tag, ip, user, created) values(?,?,?,?,?,?," + now + ")")
+	for _, row := range events {
+		res, err := stmt.Exec(row.Registry, row.Action, row.Repository, row.Tag, row.IP, row.User)
 		if err != nil {
 			e.logger.Error("Error inserting a row: ", err)
-			return
+			return manifestEvents
 		}
 		id, _ := res.LastInsertId()
 		e.logger.Debug("New event added with id ", id)
@@ -131,7 +150,7 @@ func (e *EventListener) ProcessEvents(request *http.Request) {
 
 	// Purge old records.
 	if !e.eventDeletion {
-		return
+		return manifestEvents
 	}
 	var res sql.Result
 	if e.databaseDriver == "mysql" {
@@ -143,10 +162,17 @@ func (e *EventListener) ProcessEvents(request *http.Request) {
 	}
 	count, _ := res.RowsAffected()
 	e.logger.Debug("Rows deleted: ", count)
+	return manifestEvents
 }
 
-// GetEvents retrieve events from sqlite db
-func (e *EventListener) GetEvents(repository string) []EventRow {
+// isManifestEvent whether the event is about manifest and not blob.
+// Delete events have no media type and they are always about manifests.
+func isManifestEvent(mediaType string) bool {
+	return mediaType == "" || strings.Contains(mediaType, "manifest") || strings.Contains(mediaType, "index")
+}
+
+// GetEvents retrieve events of the registry from sqlite db
+func (e *EventListener) GetEvents(registryName, repository string) []EventRow {
 	var events []EventRow
 
 	db, err := e.getDatabaseHandler()
@@ -156,12 +182,15 @@ func (e *EventListener) GetEvents(repository string) []EventRow {
 	}
 	defer db.Close()
 
-	query := "SELECT * FROM events ORDER BY id DESC LIMIT 1000"
+	query := "SELECT id, registry, action, repository, tag, ip, user, created FROM events WHERE registry=?"
+	args := []interface{}{registryName}
 	if repository != "" {
-		query = fmt.Sprintf("SELECT * FROM events WHERE repository='%s' OR repository LIKE '%s/%%' ORDER BY id DESC LIMIT 5",
-			repository, repository)
+		query += " AND (repository=? OR repository LIKE ?) ORDER BY id DESC LIMIT 5"
+		args = append(args, repository, repository+"/%")
+	} else {
+		query += " ORDER BY id DESC LIMIT 1000"
 	}
-	rows, err := db.Query(query)
+	rows, err := db.Query(query, args...)
 	if err != nil {
 		e.logger.Error("Error selecting from table: ", err)
 		return events
@@ -170,43 +199,100 @@ func (e *EventListener) GetEvents(repository string) []EventRow {
 
 	for rows.Next() {
 		var row EventRow
-		rows.Scan(&row.ID, &row.Action, &row.Repository, &row.Tag, &row.IP, &row.User, &row.Created)
+		rows.Scan(&row.ID, &row.Registry, &row.Action, &row.Repository, &row.Tag, &row.IP, &row.User, &row.Created)
 		events = append(events, row)
 	}
 	return events
 }
 
-func (e *EventListener) getDatabaseHandler() (*sql.DB, error) {
-	firstRun := false
-	schema := schemaSQLite
-	if e.databaseDriver == "sqlite3" {
-		if _, err := os.Stat(e.databaseLocation); os.IsNotExist(err) {
-			firstRun = true
+// GetPulledTags tags and digests of the repository of the registry pulled within the given number of days.
+// Digests are recorded for pulls by digest, e.g. by Kubernetes with pinned images or signed pulls.
+func (e *EventListener) GetPulledTags(registryName, repository string, days int) ([]string, error) {
+	db, err := e.getDatabaseHandler()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	// The cut-off is calculated by the database as the events are stored with its time.
+	query := "SELECT DISTINCT tag FROM events WHERE action='pull' AND registry=? AND repository=? AND created >= DateTime('now',?)"
+	cutoff := interface{}(fmt.Sprintf("-%d day", days))
+	if e.databaseDriver == "mysql" {
+		query = "SELECT DISTINCT tag FROM events WHERE action='pull' AND registry=? AND repository=? AND created >= DATE_SUB(NOW(), INTERVAL ? DAY)"
+		cutoff = days
+	}
+	rows, err := db.Query(query, registryName, repository, cutoff)
+	if err != nil {
+		return nil, fmt.Errorf("Error selecting from table: %s", err)
+	}
+	defer rows.Close()
+
+	tags := []string{}
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			return nil, err
 		}
+		tags = append(tags, tag)
 	}
+	return tags, rows.Err()
+}
 
+func (e *EventListener) getDatabaseHandler() (*sql.DB, error) {
 	// Open db connection.
 	db, err := sql.Open(e.databaseDriver, e.databaseLocation)
 	if err != nil {
 		return nil, fmt.Errorf("Error opening %s db: %s", e.databaseDriver, err)
 	}
+	if err := e.setupSchema(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
 
+// setupSchema create the events and promotions tables on first run or add the registry column to the events table
+// of older versions. It is done once, it is retried on the next call on error.
+func (e *EventListener) setupSchema(db *sql.DB) error {
+	e.schemaMux.Lock()
+	defer e.schemaMux.Unlock()
+	if e.schemaReady {
+		return nil
+	}
+
+	firstRun := false
+	schema := schemaSQLite
 	if e.databaseDriver == "mysql" {
 		schema = strings.Replace(schema, "AUTOINCREMENT", "AUTO_INCREMENT", 1)
-		rows, err := db.Query("SELECT * FROM events LIMIT 1")
-		if err != nil {
-			firstRun = true
-		}
-		if rows != nil {
-			rows.Close()
-		}
+	}
+	// The db file or database may already exist with other tables, e.g. persistent cache.
+	rows, err := db.Query("SELECT * FROM events LIMIT 1")
+	if err != nil {
+		firstRun = true
+	}
+	if rows != nil {
+		rows.Close()
 	}
 
 	// Create table on first run.
 	if firstRun {
 		if _, err = db.Exec(schema); err != nil {
-			return nil, fmt.Errorf("Error creating a table: %s", err)
+			return fmt.Errorf("Error creating a table: %s", err)
+		}
+	} else if rows, err := db.Query("SELECT registry FROM events LIMIT 1"); err != nil {
+		e.logger.Infof("Adding registry column to events table, existing events are assigned to %s registry", e.defaultRegistry)
+		if _, err = db.Exec("ALTER TABLE events ADD COLUMN registry VARCHAR(100) NULL"); err != nil {
+			return fmt.Errorf("Error adding registry column: %s", err)
+		}
+		if _, err = db.Exec("UPDATE events SET registry=? WHERE registry IS NULL", e.defaultRegistry); err != nil {
+			return fmt.Errorf("Error updating registry column: %s", err)
 		}
+	} else {
+		rows.Close()
 	}
-	return db, nil
+	if _, err = db.Exec(promotionsSchema(e.databaseDriver)); err != nil {
+		return fmt.Errorf("Error creating promotions table: %s", err)
+	}
+	e.schemaReady = true
+	return nil
 }
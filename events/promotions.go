@@ -0,0 +1,100 @@
+package events
+
+import (
+	"fmt"
+	"strings"
+)
+
+const schemaPromotions = `
+	CREATE TABLE IF NOT EXISTS promotions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		target VARCHAR(100) NULL,
+		source_registry VARCHAR(100) NULL,
+		target_registry VARCHAR(100) NULL,
+		repository VARCHAR(255) NULL,
+		tag VARCHAR(128) NULL,
+		digest VARCHAR(100) NULL,
+		referrers INTEGER NULL,
+		user VARCHAR(50) NULL,
+		error TEXT NULL,
+		created DATETIME NULL
+	);
+`
+
+// PromotionRow promotion of the image to another registry.
+type PromotionRow struct {
+	ID             int    `json:"id"`
+	Target         string `json:"target"`
+	SourceRegistry string `json:"sourceRegistry"`
+	TargetRegistry string `json:"targetRegistry"`
+	Repository     string `json:"repository"`
+	Tag            string `json:"tag"`
+	Digest         string `json:"digest"`
+	Referrers      int    `json:"referrers"`
+	User           string `json:"user"`
+	// Error is empty when the promotion succeeded.
+	Error   string `json:"error"`
+	Created string `json:"created"`
+}
+
+// RecordPromotion store the promotion, failed ones too.
+func (e *EventListener) RecordPromotion(row PromotionRow) error {
+	db, err := e.getDatabaseHandler()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	now := "DateTime('now')"
+	if e.databaseDriver == "mysql" {
+		now = "NOW()"
+	}
+	_, err = db.Exec("INSERT INTO promotions(target, source_registry, target_registry, repository, tag, digest, referrers, user, error, created) "+
+		"values(?,?,?,?,?,?,?,?,?,"+now+")",
+		row.Target, row.SourceRegistry, row.TargetRegistry, row.Repository, row.Tag, row.Digest, row.Referrers, row.User, row.Error)
+	if err != nil {
+		return fmt.Errorf("error inserting a promotion: %w", err)
+	}
+	return nil
+}
+
+// GetPromotions retrieve the latest promotions, optionally of the repo only.
+func (e *EventListener) GetPromotions(repository string) []PromotionRow {
+	promotions := []PromotionRow{}
+
+	db, err := e.getDatabaseHandler()
+	if err != nil {
+		e.logger.Error(err)
+		return promotions
+	}
+	defer db.Close()
+
+	query := "SELECT id, target, source_registry, target_registry, repository, tag, digest, referrers, user, error, created FROM promotions"
+	args := []interface{}{}
+	if repository != "" {
+		query += " WHERE repository=?"
+		args = append(args, repository)
+	}
+	rows, err := db.Query(query+" ORDER BY id DESC LIMIT 1000", args...)
+	if err != nil {
+		e.logger.Error("Error selecting from table: ", err)
+		return promotions
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var row PromotionRow
+		rows.Scan(&row.ID, &row.Target, &row.SourceRegistry, &row.TargetRegistry, &row.Repository, &row.Tag, &row.Digest,
+			&row.Referrers, &row.User, &row.Error, &row.Created)
+		promotions = append(promotions, row)
+	}
+	return promotions
+}
+
+// promotionsSchema schema of the promotions table for the database driver.
+func promotionsSchema(databaseDriver string) string {
+	if databaseDriver == "mysql" {
+		return strings.Replace(schemaPromotions, "AUTOINCREMENT", "AUTO_INCREMENT", 1)
+	}
+	return schemaPromotions
+}
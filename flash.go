@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const flashCookieName = "flash"
+
+// flashMessage one-time message shown on the next page after redirect.
+type flashMessage struct {
+	// Kind is Bootstrap alert type: success, danger, warning etc.
+	Kind    string
+	Message string
+}
+
+// setFlash store flash message in the cookie to be shown on the next page.
+func setFlash(c echo.Context, basePath, kind, message string) {
+	value, _ := json.Marshal(flashMessage{Kind: kind, Message: message})
+	c.SetCookie(&http.Cookie{
+		Name:     flashCookieName,
+		Value:    base64.URLEncoding.EncodeToString(value),
+		Path:     cookiePath(basePath),
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// getFlash read flash message from the cookie and expire it.
+func getFlash(c echo.Context, basePath string) (flashMessage, bool) {
+	var flash flashMessage
+	cookie, err := c.Cookie(flashCookieName)
+	if err != nil {
+		return flash, false
+	}
+	c.SetCookie(&http.Cookie{
+		Name:     flashCookieName,
+		Path:     cookiePath(basePath),
+		Expires:  time.Unix(0, 0),
+		MaxAge:   -1,
+		HttpOnly: true,
+	})
+
+	value, err := base64.URLEncoding.DecodeString(cookie.Value)
+	if err != nil {
+		return flash, false
+	}
+	if err := json.Unmarshal(value, &flash); err != nil {
+		return flash, false
+	}
+	return flash, true
+}
+
+// cookiePath cookie path for the base path of UI.
+func cookiePath(basePath string) string {
+	if basePath == "" {
+		return "/"
+	}
+	return basePath
+}
@@ -1,8 +1,11 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"net/http"
+	"os"
 	"path/filepath"
 	"strings"
 
@@ -15,25 +18,37 @@ import (
 )
 
 type apiClient struct {
-	client        *registry.Client
-	eventListener *events.EventListener
+	// The first client is the default registry.
+	clients          []*registry.Client
+	promotionTargets []registry.PromotionTarget
+	eventListener    *events.EventListener
+	basePath         string
 }
 
 func main() {
 	var (
 		a apiClient
 
-		configFile, loggingLevel             string
-		purgeTags, purgeDryRun               bool
-		purgeIncludeRepos, purgeExcludeRepos string
+		configFile, loggingLevel, registryName  string
+		purgeTags, purgeDryRun, purgePolicies   bool
+		purgeIncludeRepos, purgeExcludeRepos    string
+		purgeOutput, purgeApplyPlan             string
+		promoteTarget, promoteImage, promoteTag string
 	)
 	flag.StringVar(&configFile, "config-file", "config.yml", "path to the config file")
 	flag.StringVar(&loggingLevel, "log-level", "info", "logging level")
+	flag.StringVar(&registryName, "registry", "", "name of the registry to run CLI task for, otherwise the first one")
 
 	flag.BoolVar(&purgeTags, "purge-tags", false, "purge old tags instead of running a web server")
 	flag.BoolVar(&purgeDryRun, "dry-run", false, "dry-run for purging task, does not delete anything")
 	flag.StringVar(&purgeIncludeRepos, "purge-include-repos", "", "comma-separated list of repos to purge tags from, otherwise all")
 	flag.StringVar(&purgeExcludeRepos, "purge-exclude-repos", "", "comma-separated list of repos to skip from purging tags, otherwise none")
+	flag.StringVar(&purgeOutput, "purge-output", "", "write the purge plan to the JSON or CSV file (by extension) before purging")
+	flag.StringVar(&purgeApplyPlan, "purge-apply-plan", "", "purge exactly the tags listed in the plan file instead of running a web server")
+	flag.BoolVar(&purgePolicies, "purge-print-policies", false, "print the effective purge policy of each repo instead of running a web server")
+	flag.StringVar(&promoteTarget, "promote-target", "", "promote the image to the target instead of running a web server")
+	flag.StringVar(&promoteImage, "promote-image", "", "image to promote as repo:tag or repo@digest")
+	flag.StringVar(&promoteTag, "promote-tag", "", "tag of the promoted image on the target registry, defaults to the source tag")
 	flag.Parse()
 
 	// Setup logging
@@ -54,17 +69,86 @@ func main() {
 	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
 	viper.AutomaticEnv()
 
-	// Init registry API client.
-	a.client = registry.NewClient()
+	// Init registry API clients.
+	registryConfigs, err := registry.ReadRegistryConfigs()
+	if err != nil {
+		panic(err)
+	}
+	if a.promotionTargets, err = registry.ReadPromotionTargets(registryConfigs); err != nil {
+		panic(err)
+	}
+	var cache *registry.Cache
+	if viper.GetBool("performance.persistent_cache") {
+		if cache, err = registry.NewCache(); err != nil {
+			logrus.Errorf("Persistent cache is disabled: %s", err)
+		}
+	}
+	for _, cfg := range registryConfigs {
+		a.clients = append(a.clients, registry.NewClient(cfg, cache))
+	}
 
 	// Execute CLI task and exit.
 	if purgeTags {
-		registry.PurgeOldTags(a.client, purgeDryRun, purgeIncludeRepos, purgeExcludeRepos)
+		client := a.getClientByName(registryName)
+		if client == nil {
+			logrus.Errorf("Unknown registry: %s", registryName)
+			os.Exit(1)
+		}
+		eventListener := events.NewEventListener(a.clients[0].Name())
+		pulledTags := func(repo string, days int) ([]string, error) {
+			return eventListener.GetPulledTags(client.Name(), repo, days)
+		}
+		if err := registry.PurgeOldTags(context.Background(), client, purgeDryRun, purgeIncludeRepos, purgeExcludeRepos,
+			purgeOutput, pulledTags); err != nil {
+			logrus.Error(err)
+			os.Exit(1)
+		}
+		return
+	}
+	if purgeApplyPlan != "" {
+		client := a.getClientByName(registryName)
+		if client == nil {
+			logrus.Errorf("Unknown registry: %s", registryName)
+			os.Exit(1)
+		}
+		if err := registry.ApplyPurgePlan(context.Background(), client, purgeApplyPlan, purgeDryRun); err != nil {
+			logrus.Error(err)
+			os.Exit(1)
+		}
+		return
+	}
+	if purgePolicies {
+		client := a.getClientByName(registryName)
+		if client == nil {
+			logrus.Errorf("Unknown registry: %s", registryName)
+			os.Exit(1)
+		}
+		if err := registry.PrintPurgePolicies(context.Background(), client, os.Stdout, purgeIncludeRepos, purgeExcludeRepos); err != nil {
+			logrus.Error(err)
+			os.Exit(1)
+		}
+		return
+	}
+	if promoteTarget != "" {
+		client := a.getClientByName(registryName)
+		if client == nil {
+			logrus.Errorf("Unknown registry: %s", registryName)
+			os.Exit(1)
+		}
+		a.eventListener = events.NewEventListener(a.clients[0].Name())
+		res, err := a.promoteImage(context.Background(), client, promoteTarget, promoteImage, promoteTag, "cli")
+		if err != nil {
+			logrus.Error(err)
+			os.Exit(1)
+		}
+		logrus.Infof("Promoted %s@%s with %d referrers to %s.", promoteImage, res.Digest, len(res.Referrers), promoteTarget)
 		return
 	}
 
-	go a.client.StartBackgroundJobs()
-	a.eventListener = events.NewEventListener()
+	for _, client := range a.clients {
+		go client.StartBackgroundJobs(context.Background())
+	}
+	a.eventListener = events.NewEventListener(a.clients[0].Name())
 
 	// Template engine init.
 	e := echo.New()
@@ -78,20 +162,84 @@ func main() {
 	if basePath != "" {
 		basePath = "/" + basePath
 	}
+	a.basePath = basePath
 	e.Renderer = setupRenderer(basePath)
 
 	// Web routes.
 	e.File("/favicon.ico", "static/favicon.ico")
 	e.Static(basePath+"/static", "static")
 
-	p := e.Group(basePath)
+	// CSRF protection for the state-changing UI actions.
+	csrf := middleware.CSRFWithConfig(middleware.CSRFConfig{
+		TokenLookup:    "form:_csrf,header:" + echo.HeaderXCSRFToken,
+		CookiePath:     cookiePath(basePath),
+		CookieHTTPOnly: true,
+		CookieSameSite: http.SameSiteStrictMode,
+	})
+
+	p := e.Group(basePath, csrf)
 	if basePath != "" {
-		e.GET(basePath, a.viewCatalog)
+		e.GET(basePath, a.viewCatalog, csrf)
 	}
 	p.GET("/", a.viewCatalog)
 	p.GET("/:repoPath", a.viewCatalog)
 	p.GET("/event-log", a.viewEventLog)
-	p.GET("/delete-tag", a.deleteTag)
+	// "-" cannot be the first character of a repo name, so it does not clash with repos.
+	// These names are reserved and cannot be used as registry names.
+	p.GET("/-/compare/:repoPath", a.viewCompare)
+	p.GET("/-/sbom/:repoPath", a.viewSBOM)
+	p.GET("/-/search", a.viewSearch)
+	p.GET("/-/import", a.viewImport)
+	if len(a.clients) > 1 {
+		// Non-default registries, "-" cannot be the first character of a repo name.
+		p.GET("/-/:registry", a.viewCatalog)
+		p.GET("/-/:registry/", a.viewCatalog)
+		p.GET("/-/:registry/:repoPath", a.viewCatalog)
+	}
+	p.POST("/delete-tag", a.deleteTag)
+	p.DELETE("/delete-tag", a.deleteTag)
+	p.POST("/copy-image", a.copyImage)
+	p.POST("/promote", a.promote)
+	p.POST("/refresh", a.refresh)
+
+	// State-changing POST API calls require the token of "_csrf" cookie in the header.
+	// Cross-site forms can send neither the custom header nor the cookie set with SameSite.
+	apiCSRF := middleware.CSRFWithConfig(middleware.CSRFConfig{
+		TokenLookup:    "header:" + echo.HeaderXCSRFToken,
+		CookiePath:     cookiePath(basePath),
+		CookieHTTPOnly: true,
+		CookieSameSite: http.SameSiteStrictMode,
+		ErrorHandler: func(err error, c echo.Context) error {
+			return apiError(c, http.StatusForbidden, echo.HeaderXCSRFToken+" header matching _csrf cookie is required")
+		},
+	})
+
+	// JSON API.
+	// GET and DELETE calls are not protected by CSRF tokens as browsers do not allow cross-origin DELETE requests without CORS.
+	api := e.Group(basePath + "/api/v1")
+	api.GET("/registries", a.apiRegistries)
+	api.GET("/catalog", a.apiCatalog)
+	api.GET("/catalog/:repoPath", a.apiCatalog)
+	api.GET("/tags/:repoPath", a.apiTags)
+	api.POST("/tags/:repoPath", a.apiCopyImage, apiCSRF)
+	api.DELETE("/tags/:repoPath", a.apiDeleteTag)
+	api.GET("/tag-details/:repoPath", a.apiTagDetails)
+	api.GET("/tag-aliases/:repoPath", a.apiTagAliases)
+	api.GET("/image/:imageRef", a.apiImageInfo)
+	api.GET("/export/:imageRef", a.apiExport)
+	api.GET("/layer-files/:repoPath", a.apiLayerFiles)
+	api.GET("/referrers/:repoPath", a.apiReferrers)
+	api.GET("/sbom/:repoPath", a.apiSBOM)
+	api.GET("/search", a.apiSearch)
+	api.GET("/compare/:repoPath", a.apiCompare)
+	api.GET("/compare-files/:repoPath", a.apiCompareFiles)
+	api.GET("/events", a.apiEvents)
+	api.GET("/promotions", a.apiPromotions)
+	api.POST("/promote/:imageRef", a.apiPromote, apiCSRF)
+	api.POST("/imports", a.apiImport)
+	api.GET("/imports/:id", a.apiImportStatus)
+	api.POST("/refresh", a.apiRefresh, apiCSRF)
+	api.Any("/*", a.apiNotFound)
 
 	// Protected event listener.
 	pp := e.Group("/event-receiver")
@@ -0,0 +1,257 @@
+package registry
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+
+	// 🐒 patching of "database/sql".
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+var cacheSchema = []string{`
+	CREATE TABLE IF NOT EXISTS catalog (
+		registry VARCHAR(100) NOT NULL,
+		repository VARCHAR(255) NOT NULL,
+		PRIMARY KEY (registry, repository)
+	)`, `
+	CREATE TABLE IF NOT EXISTS tags (
+		registry VARCHAR(100) NOT NULL,
+		repository VARCHAR(255) NOT NULL,
+		tag VARCHAR(128) NOT NULL,
+		digest VARCHAR(100) NULL,
+		created BIGINT NULL,
+		size BIGINT NULL,
+		platforms VARCHAR(255) NULL,
+		labels TEXT NULL,
+		PRIMARY KEY (registry, repository, tag)
+	)`,
+}
+
+// Cache persistent storage of catalog and tag metadata so they are available right after restart.
+// It uses the same database as event listener.
+type Cache struct {
+	db     *sql.DB
+	logger *logrus.Entry
+}
+
+// NewCache initialize Cache and create tables if needed.
+func NewCache() (*Cache, error) {
+	databaseDriver := viper.GetString("event_listener.database_driver")
+	databaseLocation := viper.GetString("event_listener.database_location")
+
+	db, err := sql.Open(databaseDriver, databaseLocation)
+	if err != nil {
+		return nil, fmt.Errorf("error opening %s db: %w", databaseDriver, err)
+	}
+	if databaseDriver == "sqlite3" {
+		// Avoid "database is locked" errors on concurrent writes.
+		db.SetMaxOpenConns(1)
+	}
+	for _, stmt := range cacheSchema {
+		if _, err := db.Exec(stmt); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("error creating cache tables: %w", err)
+		}
+	}
+	return &Cache{db: db, logger: SetupLogging("registry.cache")}, nil
+}
+
+// LoadCatalog load the list of repos of the registry.
+func (c *Cache) LoadCatalog(registry string) ([]string, error) {
+	rows, err := c.db.Query("SELECT repository FROM catalog WHERE registry=? ORDER BY repository", registry)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	repos := []string{}
+	for rows.Next() {
+		var repo string
+		if err := rows.Scan(&repo); err != nil {
+			return nil, err
+		}
+		repos = append(repos, repo)
+	}
+	return repos, rows.Err()
+}
+
+// SaveCatalog replace the list of repos of the registry.
+func (c *Cache) SaveCatalog(registry string, repos []string) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM catalog WHERE registry=?", registry); err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare("INSERT INTO catalog(registry, repository) VALUES(?,?)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, repo := range UniqueSortedSlice(append([]string{}, repos...)) {
+		if _, err := stmt.Exec(registry, repo); err != nil {
+			return err
+		}
+	}
+	// Drop tags of the repos which are gone.
+	if _, err := tx.Exec("DELETE FROM tags WHERE registry=? AND repository NOT IN (SELECT repository FROM catalog WHERE registry=?)",
+		registry, registry); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// LoadTagCounts load tag counts per repo of the registry.
+func (c *Cache) LoadTagCounts(registry string) (map[string]int, error) {
+	rows, err := c.db.Query("SELECT repository, COUNT(*) FROM tags WHERE registry=? GROUP BY repository", registry)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[string]int{}
+	for rows.Next() {
+		var repo string
+		var count int
+		if err := rows.Scan(&repo, &count); err != nil {
+			return nil, err
+		}
+		counts[repo] = count
+	}
+	return counts, rows.Err()
+}
+
+// SaveTags update the list of tags of the repo preserving metadata of the existing tags.
+func (c *Cache) SaveTags(registry, repo string, tags []string) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query("SELECT tag FROM tags WHERE registry=? AND repository=?", registry, repo)
+	if err != nil {
+		return err
+	}
+	existing := map[string]bool{}
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			rows.Close()
+			return err
+		}
+		existing[tag] = true
+	}
+	rows.Close()
+
+	for _, tag := range tags {
+		if existing[tag] {
+			delete(existing, tag)
+			continue
+		}
+		if _, err := tx.Exec("INSERT INTO tags(registry, repository, tag) VALUES(?,?,?)", registry, repo, tag); err != nil {
+			return err
+		}
+	}
+	// Whatever left is gone.
+	for tag := range existing {
+		if _, err := tx.Exec("DELETE FROM tags WHERE registry=? AND repository=? AND tag=?", registry, repo, tag); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// LoadTags load tags per repo of the registry and details of the tags by "repo:tag" if known.
+func (c *Cache) LoadTags(registry string) (map[string][]string, map[string]TagDetails, error) {
+	rows, err := c.db.Query("SELECT repository, tag, digest, created, size, platforms, labels FROM tags WHERE registry=? ORDER BY repository, tag", registry)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	tags := map[string][]string{}
+	details := map[string]TagDetails{}
+	for rows.Next() {
+		var repo, tag string
+		var digest, platforms, labels sql.NullString
+		var created, size sql.NullInt64
+		if err := rows.Scan(&repo, &tag, &digest, &created, &size, &platforms, &labels); err != nil {
+			return nil, nil, err
+		}
+		tags[repo] = append(tags[repo], tag)
+		if digest.Valid {
+			details[repo+":"+tag] = TagDetails{Tag: tag, Digest: digest.String, Created: fromUnix(created), Size: size.Int64,
+				Platforms: platforms.String, Labels: fromJSON(labels)}
+		}
+	}
+	return tags, details, rows.Err()
+}
+
+// SaveTagDetails store digest, created time, size, platforms and labels of the tag.
+func (c *Cache) SaveTagDetails(registry, repo string, d TagDetails) error {
+	_, err := c.db.Exec("REPLACE INTO tags(registry, repository, tag, digest, created, size, platforms, labels) VALUES(?,?,?,?,?,?,?,?)",
+		registry, repo, d.Tag, d.Digest, toUnix(d.Created), d.Size, d.Platforms, toJSON(d.Labels))
+	return err
+}
+
+// GetTagDetailsByDigest get details of the image by its digest if known, the tag is not set.
+func (c *Cache) GetTagDetailsByDigest(registry, repo, digest string) (TagDetails, bool) {
+	var created, size sql.NullInt64
+	var platforms, labels sql.NullString
+	err := c.db.QueryRow("SELECT created, size, platforms, labels FROM tags WHERE registry=? AND repository=? AND digest=? LIMIT 1",
+		registry, repo, digest).Scan(&created, &size, &platforms, &labels)
+	if err != nil {
+		return TagDetails{}, false
+	}
+	return TagDetails{Digest: digest, Created: fromUnix(created), Size: size.Int64, Platforms: platforms.String, Labels: fromJSON(labels)}, true
+}
+
+// DeleteTag delete the tag of the repo.
+func (c *Cache) DeleteTag(registry, repo, tag string) error {
+	_, err := c.db.Exec("DELETE FROM tags WHERE registry=? AND repository=? AND tag=?", registry, repo, tag)
+	return err
+}
+
+// toUnix convert time to unix timestamp, zero time is stored as NULL.
+func toUnix(t time.Time) sql.NullInt64 {
+	if t.IsZero() {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: t.Unix(), Valid: true}
+}
+
+// toJSON encode labels as JSON, empty labels are stored as NULL.
+func toJSON(labels map[string]string) sql.NullString {
+	if len(labels) == 0 {
+		return sql.NullString{}
+	}
+	b, _ := json.Marshal(labels)
+	return sql.NullString{String: string(b), Valid: true}
+}
+
+// fromJSON decode labels from JSON, NULL is nil map.
+func fromJSON(s sql.NullString) map[string]string {
+	var labels map[string]string
+	if s.Valid {
+		json.Unmarshal([]byte(s.String), &labels)
+	}
+	return labels
+}
+
+// fromUnix convert unix timestamp to time, NULL is zero time.
+func fromUnix(ts sql.NullInt64) time.Time {
+	if !ts.Valid {
+		return time.Time{}
+	}
+	return time.Unix(ts.Int64, 0).UTC()
+}
@@ -3,9 +3,16 @@ package registry
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
 	"os"
+	"slices"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/go-containerregistry/pkg/authn"
@@ -14,48 +21,106 @@ import (
 	"github.com/google/go-containerregistry/pkg/v1/remote"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
+	"golang.org/x/time/rate"
 )
 
 const userAgent = "registry-ui"
 
 // Client main class.
 type Client struct {
+	name           string
+	hostname       string
+	pullOptions    []remote.Option
+	pushOptions    []remote.Option
+	remoteMux      sync.Mutex
 	puller         *remote.Puller
 	pusher         *remote.Pusher
+	remoteFailed   atomic.Bool
 	logger         *logrus.Entry
+	reposMux       sync.RWMutex
 	repos          []string
 	tagCountsMux   sync.Mutex
 	tagCounts      map[string]int
-	isCatalogReady bool
+	repoTags       map[string][]string
+	isCatalogReady atomic.Bool
 	nameOptions    []name.Option
+	timeouts       timeouts
+	cache          *Cache
+
+	tagDetailsMux sync.RWMutex
+	tagDetails    map[string]TagDetails
+
+	importsMux sync.Mutex
+	imports    map[string]*ImportJob
+
+	tagsCountConcurrency int
+	tagsCountRunning     atomic.Bool
+	refreshRunning       atomic.Bool
+	tagsCountDone        atomic.Int64
+	tagsCountTotal       atomic.Int64
+}
+
+// Progress progress of the background job.
+type Progress struct {
+	Running bool `json:"running"`
+	Done    int  `json:"done"`
+	Total   int  `json:"total"`
+}
+
+// timeouts per-operation timeouts of the registry API calls in seconds, 0 means no timeout.
+type timeouts struct {
+	catalog    int
+	listTags   int
+	imageInfo  int
+	deleteTag  int
+	layerFiles int
+	copyImage  int
 }
 
 type ImageInfo struct {
-	IsImageIndex   bool
-	IsImage        bool
-	ImageRefRepo   string
-	ImageRefTag    string
-	ImageRefDigest string
-	MediaType      string
-	Platforms      string
-	Manifest       map[string]interface{}
+	IsImageIndex   bool                   `json:"isImageIndex"`
+	IsImage        bool                   `json:"isImage"`
+	ImageRefRepo   string                 `json:"imageRefRepo"`
+	ImageRefTag    string                 `json:"imageRefTag"`
+	ImageRefDigest string                 `json:"imageRefDigest"`
+	MediaType      string                 `json:"mediaType"`
+	Platforms      string                 `json:"platforms"`
+	Manifest       map[string]interface{} `json:"manifest"`
 
 	// Image specific
-	ImageSize     int64
-	Created       time.Time
-	ConfigImageID string
-	ConfigFile    map[string]interface{}
+	ImageSize     int64                  `json:"imageSize,omitempty"`
+	Created       time.Time              `json:"created"`
+	ConfigImageID string                 `json:"configImageID,omitempty"`
+	ConfigFile    map[string]interface{} `json:"configFile,omitempty"`
+	Layers        []LayerInfo            `json:"layers,omitempty"`
+
+	// Parsed config file and index manifest used to compare images.
+	config *v1.ConfigFile
+	index  *v1.IndexManifest
+}
+
+// TagDetails tag summary shown in the tag list.
+// For image index, created time and size are of the image of the default platform.
+type TagDetails struct {
+	Tag       string    `json:"tag"`
+	Digest    string    `json:"digest"`
+	Created   time.Time `json:"created"`
+	Size      int64     `json:"size"`
+	Platforms string    `json:"platforms"`
+	// Labels of the image config, of the default platform image for image index.
+	Labels map[string]string `json:"labels,omitempty"`
 }
 
-// NewClient initialize Client.
-func NewClient() *Client {
+// NewClient initialize Client for the registry.
+// Persistent cache is optional, when set the catalog and tag counts are loaded from it.
+func NewClient(cfg RegistryConfig, cache *Cache) *Client {
 	var authOpt remote.Option
-	if viper.GetBool("registry.auth_with_keychain") {
+	if cfg.AuthWithKeychain {
 		authOpt = remote.WithAuthFromKeychain(authn.DefaultKeychain)
 	} else {
-		password := viper.GetString("registry.password")
+		password := cfg.Password
 		if password == "" {
-			passwdFile := viper.GetString("registry.password_file")
+			passwdFile := cfg.PasswordFile
 			if _, err := os.Stat(passwdFile); os.IsNotExist(err) {
 				panic(err)
 			}
@@ -67,63 +132,127 @@ func NewClient() *Client {
 		}
 
 		authOpt = remote.WithAuth(authn.FromConfig(authn.AuthConfig{
-			Username: viper.GetString("registry.username"), Password: password,
+			Username: cfg.Username, Password: password,
 		}))
 	}
 
-	pageSize := viper.GetInt("performance.catalog_page_size")
-	puller, _ := remote.NewPuller(authOpt, remote.WithUserAgent(userAgent), remote.WithPageSize(pageSize))
-	pusher, _ := remote.NewPusher(authOpt, remote.WithUserAgent(userAgent))
+	var transport http.RoundTripper = remote.DefaultTransport
+	if cfg.RequestsPerSecond > 0 {
+		burst := int(math.Max(1, cfg.RequestsPerSecond))
+		transport = &rateLimitedTransport{limiter: rate.NewLimiter(rate.Limit(cfg.RequestsPerSecond), burst), next: transport}
+	}
 
-	insecure := viper.GetBool("registry.insecure")
 	nameOptions := []name.Option{}
-	if insecure {
+	if cfg.Insecure {
 		nameOptions = append(nameOptions, name.Insecure)
 	}
 
 	c := &Client{
-		puller:      puller,
-		pusher:      pusher,
-		logger:      SetupLogging("registry.client"),
+		name:        cfg.Name,
+		hostname:    cfg.Hostname,
+		logger:      SetupLogging("registry.client").WithField("registry", cfg.Name),
 		repos:       []string{},
 		tagCounts:   map[string]int{},
+		repoTags:    map[string][]string{},
+		tagDetails:  map[string]TagDetails{},
+		imports:     map[string]*ImportJob{},
 		nameOptions: nameOptions,
+		timeouts: timeouts{
+			catalog:    viper.GetInt("performance.catalog_timeout"),
+			listTags:   viper.GetInt("performance.list_tags_timeout"),
+			imageInfo:  viper.GetInt("performance.image_info_timeout"),
+			deleteTag:  viper.GetInt("performance.delete_tag_timeout"),
+			layerFiles: viper.GetInt("performance.layer_files_timeout"),
+			copyImage:  viper.GetInt("performance.copy_image_timeout"),
+		},
+		cache:                cache,
+		tagsCountConcurrency: max(1, viper.GetInt("performance.tags_count_concurrency")),
 	}
+	transport = &contextErrorTransport{failed: &c.remoteFailed, next: transport}
+	c.pushOptions = []remote.Option{authOpt, remote.WithTransport(transport), remote.WithUserAgent(userAgent)}
+	c.pullOptions = append([]remote.Option{remote.WithPageSize(viper.GetInt("performance.catalog_page_size"))}, c.pushOptions...)
+	c.puller, _ = remote.NewPuller(c.pullOptions...)
+	c.pusher, _ = remote.NewPusher(c.pushOptions...)
+	c.loadCache()
 	return c
 }
 
-func (c *Client) StartBackgroundJobs() {
+// loadCache load catalog and tag counts from the persistent cache.
+func (c *Client) loadCache() {
+	if c.cache == nil {
+		return
+	}
+	repos, err := c.cache.LoadCatalog(c.name)
+	if err != nil {
+		c.logger.Errorf("Error loading catalog from cache: %s", err)
+		return
+	}
+	tagCounts, err := c.cache.LoadTagCounts(c.name)
+	if err != nil {
+		c.logger.Errorf("Error loading tag counts from cache: %s", err)
+		return
+	}
+	repoTags, tagDetails, err := c.cache.LoadTags(c.name)
+	if err != nil {
+		c.logger.Errorf("Error loading tags from cache: %s", err)
+		return
+	}
+	if len(repos) > 0 {
+		c.setRepos(repos)
+		c.tagCounts = tagCounts
+		c.repoTags = repoTags
+		c.tagDetails = tagDetails
+		c.isCatalogReady.Store(true)
+		c.logger.Infof("Loaded from cache: %d repos", len(repos))
+	}
+}
+
+// catalogRetryInterval interval of retrying the catalog refresh until it succeeds for the first time.
+const catalogRetryInterval = 30 * time.Second
+
+// StartBackgroundJobs refresh catalog and count tags regularly until the context is done.
+// While the catalog is not ready, its refresh is retried without affecting the other registries.
+func (c *Client) StartBackgroundJobs(ctx context.Context) {
 	catalogInterval := viper.GetInt("performance.catalog_refresh_interval")
 	tagsCountInterval := viper.GetInt("performance.tags_count_refresh_interval")
 	isStarted := false
 	for {
-		c.RefreshCatalog()
-		if !isStarted && tagsCountInterval > 0 {
-			// Start after the first catalog refresh
-			go c.CountTags(tagsCountInterval)
-			isStarted = true
+		interval := time.Duration(catalogInterval) * time.Minute
+		if err := c.RefreshCatalog(ctx); err != nil && !c.isCatalogReady.Load() {
+			c.logger.Errorf("Catalog is not ready, retrying in %s.", catalogRetryInterval)
+			interval = catalogRetryInterval
+		} else {
+			if !isStarted && tagsCountInterval > 0 {
+				// Start after the first catalog refresh
+				go c.CountTags(ctx, tagsCountInterval)
+				isStarted = true
+			}
+			if catalogInterval == 0 {
+				c.logger.Warn("Catalog refresh is disabled in the config and will not run anymore.")
+				break
+			}
 		}
-		if catalogInterval == 0 {
-			c.logger.Warn("Catalog refresh is disabled in the config and will not run anymore.")
-			break
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
 		}
-		time.Sleep(time.Duration(catalogInterval) * time.Minute)
 	}
 
 }
 
-func (c *Client) RefreshCatalog() {
-	ctx := context.Background()
+// RefreshCatalog read the full catalog from the registry.
+// On error the previous catalog is kept, the repos received so far are shown only until the catalog is ready.
+func (c *Client) RefreshCatalog(ctx context.Context) error {
+	ctx, cancel := withTimeout(ctx, c.timeouts.catalog)
+	defer cancel()
 	start := time.Now()
 	c.logger.Info("[RefreshCatalog] Started reading catalog...")
-	registry, _ := name.NewRegistry(viper.GetString("registry.hostname"), c.nameOptions...)
-	cat, err := c.puller.Catalogger(ctx, registry)
+	registry, _ := name.NewRegistry(c.hostname, c.nameOptions...)
+	cat, err := c.getPuller().Catalogger(ctx, registry)
 	if err != nil {
 		c.logger.Errorf("[RefreshCatalog] Error fetching catalog: %s", err)
-		if !c.isCatalogReady {
-			os.Exit(1)
-		}
-		return
+		return wrapError(err)
 	}
 	repos := []string{}
 	// The library itself does retries under the hood.
@@ -131,62 +260,115 @@ func (c *Client) RefreshCatalog() {
 		data, err := cat.Next(ctx)
 		if err != nil {
 			c.logger.Errorf("[RefreshCatalog] Error listing catalog: %s", err)
+			return wrapError(err)
 		}
 		if data != nil {
 			repos = append(repos, data.Repos...)
-			if !c.isCatalogReady {
-				c.repos = append(c.repos, data.Repos...)
+			if !c.isCatalogReady.Load() {
+				// The pages received by the previous failed attempt are replaced, not appended to.
+				c.setRepos(append([]string{}, repos...))
 				c.logger.Debug("[RefreshCatalog] Repo batch received:", data.Repos)
 			}
 		}
 	}
 
 	if len(repos) > 0 {
-		c.repos = repos
+		c.setRepos(repos)
+		if c.cache != nil {
+			if err := c.cache.SaveCatalog(c.name, repos); err != nil {
+				c.logger.Errorf("[RefreshCatalog] Error saving catalog to cache: %s", err)
+			}
+		}
 	} else {
 		c.logger.Warn("[RefreshCatalog] Catalog looks empty, preserving previous list if any.")
 	}
-	c.logger.Debugf("[RefreshCatalog] Catalog: %s", c.repos)
-	c.logger.Infof("[RefreshCatalog] Job complete (%v): %d repos found", time.Since(start), len(c.repos))
-	c.isCatalogReady = true
+	c.logger.Debugf("[RefreshCatalog] Catalog: %s", c.GetRepos())
+	c.logger.Infof("[RefreshCatalog] Job complete (%v): %d repos found", time.Since(start), len(c.GetRepos()))
+	c.isCatalogReady.Store(true)
+	return nil
+}
+
+// Name registry name as configured.
+func (c *Client) Name() string {
+	return c.name
+}
+
+// Hostname registry hostname.
+func (c *Client) Hostname() string {
+	return c.hostname
 }
 
 // IsCatalogReady whether catalog is ready for the first time use
 func (c *Client) IsCatalogReady() bool {
-	return c.isCatalogReady
+	return c.isCatalogReady.Load()
 }
 
 // GetRepos get all repos
 func (c *Client) GetRepos() []string {
+	c.reposMux.RLock()
+	defer c.reposMux.RUnlock()
 	return c.repos
 }
 
+// setRepos replace the list of repos.
+// The slice is never modified in place afterwards, so it is safe to read what GetRepos returned.
+func (c *Client) setRepos(repos []string) {
+	c.reposMux.Lock()
+	c.repos = repos
+	c.reposMux.Unlock()
+}
+
+// addRepo add the repo to the list if it is not there yet, return whether it is new.
+func (c *Client) addRepo(repo string) bool {
+	c.reposMux.Lock()
+	defer c.reposMux.Unlock()
+	if ItemInSlice(repo, c.repos) {
+		return false
+	}
+	repos := append(append(make([]string, 0, len(c.repos)+1), c.repos...), repo)
+	sort.Strings(repos)
+	c.repos = repos
+	return true
+}
+
 // ListTags get tags for the repo
-func (c *Client) ListTags(repoName string) []string {
-	ctx := context.Background()
-	repo, _ := name.NewRepository(viper.GetString("registry.hostname")+"/"+repoName, c.nameOptions...)
-	tags, err := c.puller.List(ctx, repo)
+func (c *Client) ListTags(ctx context.Context, repoName string) ([]string, error) {
+	ctx, cancel := withTimeout(ctx, c.timeouts.listTags)
+	defer cancel()
+	repo, err := name.NewRepository(c.hostname+"/"+repoName, c.nameOptions...)
+	if err != nil {
+		return nil, err
+	}
+	tags, err := c.getPuller().List(ctx, repo)
 	if err != nil {
 		c.logger.Errorf("Error listing tags for repo %s: %s", repoName, err)
+		return nil, wrapError(err)
 	}
 	c.tagCountsMux.Lock()
 	c.tagCounts[repoName] = len(tags)
+	c.repoTags[repoName] = append([]string{}, tags...)
 	c.tagCountsMux.Unlock()
-	return tags
+	if c.cache != nil {
+		if err := c.cache.SaveTags(c.name, repoName, tags); err != nil {
+			c.logger.Errorf("Error saving tags of repo %s to cache: %s", repoName, err)
+		}
+	}
+	return tags, nil
 }
 
 // GetImageInfo get image info by the reference - tag name or digest sha256.
-func (c *Client) GetImageInfo(imageRef string) (ImageInfo, error) {
-	ctx := context.Background()
-	ref, err := name.ParseReference(viper.GetString("registry.hostname")+"/"+imageRef, c.nameOptions...)
+func (c *Client) GetImageInfo(ctx context.Context, imageRef string) (ImageInfo, error) {
+	ctx, cancel := withTimeout(ctx, c.timeouts.imageInfo)
+	defer cancel()
+	ref, err := name.ParseReference(c.hostname+"/"+imageRef, c.nameOptions...)
 	if err != nil {
 		c.logger.Errorf("Error parsing image reference %s: %s", imageRef, err)
 		return ImageInfo{}, err
 	}
-	descr, err := c.puller.Get(ctx, ref)
+	descr, err := c.getPuller().Get(ctx, ref)
 	if err != nil {
 		c.logger.Errorf("Error fetching image reference %s: %s", imageRef, err)
-		return ImageInfo{}, err
+		return ImageInfo{}, wrapError(err)
 	}
 
 	ii := ImageInfo{
@@ -201,33 +383,33 @@ func (c *Client) GetImageInfo(imageRef string) (ImageInfo, error) {
 		ii.IsImage = true
 	} else {
 		c.logger.Errorf("Image reference %s is neither Index nor Image", imageRef)
-		return ImageInfo{}, err
+		return ImageInfo{}, fmt.Errorf("image reference %s is neither Index nor Image: %s", imageRef, descr.MediaType)
 	}
 
 	if ii.IsImage {
 		img, err := descr.Image()
 		if err != nil {
 			c.logger.Errorf("Cannot convert descriptor to Image for image reference %s: %s", imageRef, err)
-			return ImageInfo{}, err
+			return ImageInfo{}, wrapError(err)
 		}
 		cfg, err := img.ConfigFile()
 		if err != nil {
 			c.logger.Errorf("Cannot fetch ConfigFile for image reference %s: %s", imageRef, err)
-			return ImageInfo{}, err
+			return ImageInfo{}, wrapError(err)
 		}
 		ii.Created = cfg.Created.Time
 		ii.Platforms = getPlatform(cfg.Platform())
 		ii.ConfigFile = structToMap(cfg)
+		ii.config = cfg
 		// ImageID is what is shown in the terminal when doing "docker images".
 		// This is a config sha256 of the corresponding image manifest (single platform).
 		if x, _ := img.ConfigName(); len(x.String()) > 19 {
 			ii.ConfigImageID = x.String()[7:19]
 		}
 		mf, _ := img.Manifest()
-		for _, l := range mf.Layers {
-			ii.ImageSize += l.Size
-		}
+		ii.ImageSize = imageSize(mf)
 		ii.Manifest = structToMap(mf)
+		ii.Layers = imageLayers(mf, cfg)
 	} else if ii.IsImageIndex {
 		// In case of Image Index, if we request for Image() > ConfigFile(), it will be resolved
 		// to a config of one of the manifests (one of the platforms).
@@ -235,61 +417,226 @@ func (c *Client) GetImageInfo(imageRef string) (ImageInfo, error) {
 		imgIdx, err := descr.ImageIndex()
 		if err != nil {
 			c.logger.Errorf("Cannot convert descriptor to ImageIndex for image reference %s: %s", imageRef, err)
-			return ImageInfo{}, err
+			return ImageInfo{}, wrapError(err)
 		}
 		IdxMf, _ := imgIdx.IndexManifest()
-		platforms := []string{}
-		for _, m := range IdxMf.Manifests {
-			platforms = append(platforms, getPlatform(m.Platform))
-		}
-		ii.Platforms = strings.Join(UniqueSortedSlice(platforms), ", ")
+		ii.Platforms = indexPlatforms(IdxMf)
 		ii.Manifest = structToMap(IdxMf)
+		ii.index = IdxMf
 	}
 
 	return ii, nil
 }
 
-func getPlatform(p *v1.Platform) string {
-	if p != nil {
-		return p.String()
+// GetTagDetails get digest, created time, size, platforms and labels of the tag.
+// Details are cached by digest, so only a cheap HEAD request is made for the known images.
+func (c *Client) GetTagDetails(ctx context.Context, repoName, tag string) (TagDetails, error) {
+	ctx, cancel := withTimeout(ctx, c.timeouts.imageInfo)
+	defer cancel()
+	ref, err := name.NewTag(c.hostname+"/"+repoName+":"+tag, c.nameOptions...)
+	if err != nil {
+		return TagDetails{}, err
 	}
-	return ""
+	head, err := c.getPuller().Head(ctx, ref)
+	if err != nil {
+		return TagDetails{}, wrapError(err)
+	}
+	digest := head.Digest.String()
+
+	key := repoName + ":" + tag
+	c.tagDetailsMux.RLock()
+	d, ok := c.tagDetails[key]
+	c.tagDetailsMux.RUnlock()
+	if ok && d.Digest == digest {
+		return d, nil
+	}
+
+	// The tag is new or points to another image now.
+	ok = false
+	if c.cache != nil {
+		if d, ok = c.cache.GetTagDetailsByDigest(c.name, repoName, digest); ok {
+			d.Tag = tag
+		}
+	}
+	if !ok {
+		if d, err = c.fetchTagDetails(ctx, ref); err != nil {
+			c.logger.Errorf("Error fetching details of image %s: %s", key, err)
+			return TagDetails{}, err
+		}
+	}
+	if c.cache != nil {
+		if err := c.cache.SaveTagDetails(c.name, repoName, d); err != nil {
+			c.logger.Errorf("Error saving details of image %s to cache: %s", key, err)
+		}
+	}
+	c.tagDetailsMux.Lock()
+	c.tagDetails[key] = d
+	c.tagDetailsMux.Unlock()
+	return d, nil
 }
 
-// structToMap convert struct to map so it can be formatted as HTML table easily
-func structToMap(obj interface{}) map[string]interface{} {
-	var res map[string]interface{}
-	jsonBytes, _ := json.Marshal(obj)
-	json.Unmarshal(jsonBytes, &res)
-	return res
+// GetTagsDetails get details of the tags of the repo concurrently, errors are returned per tag.
+func (c *Client) GetTagsDetails(ctx context.Context, repoName string, tags []string) ([]TagDetails, []error) {
+	details := make([]TagDetails, len(tags))
+	errs := make([]error, len(tags))
+	sem := make(chan struct{}, c.tagsCountConcurrency)
+	var wg sync.WaitGroup
+	for i, tag := range tags {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			details[i], errs[i] = c.GetTagDetails(ctx, repoName, tag)
+			<-sem
+		}()
+	}
+	wg.Wait()
+	return details, errs
 }
 
-// GetImageCreated get image created time
-func (c *Client) GetImageCreated(imageRef string) time.Time {
-	zeroTime := new(time.Time)
-	ctx := context.Background()
-	ref, err := name.ParseReference(viper.GetString("registry.hostname")+"/"+imageRef, c.nameOptions...)
+// fetchTagDetails fetch details of the tag from the registry.
+func (c *Client) fetchTagDetails(ctx context.Context, ref name.Tag) (TagDetails, error) {
+	descr, err := c.getPuller().Get(ctx, ref)
 	if err != nil {
-		c.logger.Errorf("Error parsing image reference %s: %s", imageRef, err)
-		return *zeroTime
+		return TagDetails{}, wrapError(err)
 	}
-	descr, err := c.puller.Get(ctx, ref)
-	if err != nil {
-		c.logger.Errorf("Error fetching image reference %s: %s", imageRef, err)
-		return *zeroTime
+	d := TagDetails{Tag: ref.TagStr(), Digest: descr.Digest.String()}
+	if descr.MediaType.IsIndex() {
+		imgIdx, err := descr.ImageIndex()
+		if err != nil {
+			return TagDetails{}, wrapError(err)
+		}
+		idxMf, err := imgIdx.IndexManifest()
+		if err != nil {
+			return TagDetails{}, wrapError(err)
+		}
+		d.Platforms = indexPlatforms(idxMf)
+	} else if !descr.MediaType.IsImage() {
+		return TagDetails{}, fmt.Errorf("image reference %s is neither Index nor Image: %s", ref, descr.MediaType)
 	}
-	// In case of ImageIndex, it is resolved to a random sub-image which should be fine.
+
+	// In case of ImageIndex, it is resolved to the image of the default platform,
+	// so the created time and size are of that image.
 	img, err := descr.Image()
 	if err != nil {
-		c.logger.Errorf("Cannot convert descriptor to Image for image reference %s: %s", imageRef, err)
-		return *zeroTime
+		return TagDetails{}, wrapError(err)
 	}
 	cfg, err := img.ConfigFile()
 	if err != nil {
-		c.logger.Errorf("Cannot fetch ConfigFile for image reference %s: %s", imageRef, err)
-		return *zeroTime
+		return TagDetails{}, wrapError(err)
 	}
-	return cfg.Created.Time
+	mf, err := img.Manifest()
+	if err != nil {
+		return TagDetails{}, wrapError(err)
+	}
+	d.Created = cfg.Created.Time.UTC()
+	d.Size = imageSize(mf)
+	d.Labels = cfg.Config.Labels
+	if d.Platforms == "" {
+		d.Platforms = getPlatform(cfg.Platform())
+	}
+	return d, nil
+}
+
+// rateLimitedTransport limit the rate of requests to the registry.
+type rateLimitedTransport struct {
+	limiter *rate.Limiter
+	next    http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *rateLimitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.limiter.Wait(req.Context()); err != nil {
+		return nil, err
+	}
+	return t.next.RoundTrip(req)
+}
+
+// contextErrorTransport flag the requests failed because of the context cancellation or timeout.
+type contextErrorTransport struct {
+	failed *atomic.Bool
+	next   http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *contextErrorTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		t.failed.Store(true)
+	}
+	return resp, err
+}
+
+// getPuller get the puller, it is recreated after a request failed because of the context.
+// The puller caches the transport of each repo set up by the first call, including the error,
+// so the repo would fail until restart if the context of the first call was done while pinging the registry.
+func (c *Client) getPuller() *remote.Puller {
+	c.resetRemote()
+	c.remoteMux.Lock()
+	defer c.remoteMux.Unlock()
+	return c.puller
+}
+
+// getPusher get the pusher, it is recreated for the same reason as the puller.
+func (c *Client) getPusher() *remote.Pusher {
+	c.resetRemote()
+	c.remoteMux.Lock()
+	defer c.remoteMux.Unlock()
+	return c.pusher
+}
+
+// resetRemote recreate the puller and pusher if any request failed because of the context since the last call.
+func (c *Client) resetRemote() {
+	if !c.remoteFailed.CompareAndSwap(true, false) {
+		return
+	}
+	puller, _ := remote.NewPuller(c.pullOptions...)
+	pusher, _ := remote.NewPusher(c.pushOptions...)
+	c.remoteMux.Lock()
+	c.puller, c.pusher = puller, pusher
+	c.remoteMux.Unlock()
+	c.logger.Debug("Registry transport is reset after the context error")
+}
+
+// withTimeout derive the context with the timeout in seconds if set.
+func withTimeout(ctx context.Context, seconds int) (context.Context, context.CancelFunc) {
+	if seconds <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, time.Duration(seconds)*time.Second)
+}
+
+func getPlatform(p *v1.Platform) string {
+	if p != nil {
+		return p.String()
+	}
+	return ""
+}
+
+// imageSize total size of the image layers.
+func imageSize(mf *v1.Manifest) int64 {
+	var size int64
+	for _, l := range mf.Layers {
+		size += l.Size
+	}
+	return size
+}
+
+// indexPlatforms comma-separated list of the platforms of the image index.
+func indexPlatforms(idxMf *v1.IndexManifest) string {
+	platforms := []string{}
+	for _, m := range idxMf.Manifests {
+		platforms = append(platforms, getPlatform(m.Platform))
+	}
+	return strings.Join(UniqueSortedSlice(platforms), ", ")
+}
+
+// structToMap convert struct to map so it can be formatted as HTML table easily
+func structToMap(obj interface{}) map[string]interface{} {
+	var res map[string]interface{}
+	jsonBytes, _ := json.Marshal(obj)
+	json.Unmarshal(jsonBytes, &res)
+	return res
 }
 
 // SubRepoTagCounts return map with tag counts according to the provided list of repos/sub-repos etc.
@@ -314,50 +661,235 @@ func (c *Client) SubRepoTagCounts(repoPath string, repos []string) map[string]in
 }
 
 // CountTags count repository tags in background regularly.
-func (c *Client) CountTags(interval int) {
+func (c *Client) CountTags(ctx context.Context, interval int) {
 	for {
-		start := time.Now()
-		c.logger.Info("[CountTags] Started counting tags...")
-		for _, r := range c.repos {
-			c.ListTags(r)
+		c.CountTagsOnce(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Duration(interval) * time.Minute):
+		}
+	}
+}
+
+// CountTagsOnce count tags of all repos with concurrent workers, skip if it is already running.
+func (c *Client) CountTagsOnce(ctx context.Context) {
+	if !c.tagsCountRunning.CompareAndSwap(false, true) {
+		c.logger.Info("[CountTags] Already running, skipping.")
+		return
+	}
+	defer c.tagsCountRunning.Store(false)
+
+	start := time.Now()
+	repos := c.GetRepos()
+	c.tagsCountDone.Store(0)
+	c.tagsCountTotal.Store(int64(len(repos)))
+	c.logger.Infof("[CountTags] Started counting tags of %d repos with %d workers...", len(repos), c.tagsCountConcurrency)
+
+	queue := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < c.tagsCountConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for r := range queue {
+				// Errors are logged by ListTags.
+				c.ListTags(ctx, r)
+				c.tagsCountDone.Add(1)
+			}
+		}()
+	}
+	for _, r := range repos {
+		if ctx.Err() != nil {
+			break
 		}
-		c.logger.Infof("[CountTags] Job complete (%v).", time.Since(start))
-		time.Sleep(time.Duration(interval) * time.Minute)
+		queue <- r
+	}
+	close(queue)
+	wg.Wait()
+	c.logger.Infof("[CountTags] Job complete (%v).", time.Since(start))
+}
+
+// Refresh refresh the catalog and count tags of all repos in background.
+// It returns false if the refresh or tags counting is already running.
+func (c *Client) Refresh() bool {
+	if c.tagsCountRunning.Load() || !c.refreshRunning.CompareAndSwap(false, true) {
+		return false
+	}
+	go func() {
+		defer c.refreshRunning.Store(false)
+		ctx := context.Background()
+		if err := c.RefreshCatalog(ctx); err != nil {
+			return
+		}
+		c.CountTagsOnce(ctx)
+	}()
+	return true
+}
+
+// TagsCountProgress progress of the current or the last tags counting.
+func (c *Client) TagsCountProgress() Progress {
+	return Progress{
+		Running: c.tagsCountRunning.Load(),
+		Done:    int(c.tagsCountDone.Load()),
+		Total:   int(c.tagsCountTotal.Load()),
 	}
 }
 
 // DeleteTag delete image tag.
-func (c *Client) DeleteTag(repoPath, tag string) {
-	ctx := context.Background()
+func (c *Client) DeleteTag(ctx context.Context, repoPath, tag string) error {
+	ctx, cancel := withTimeout(ctx, c.timeouts.deleteTag)
+	defer cancel()
 	imageRef := repoPath + ":" + tag
-	ref, err := name.ParseReference(viper.GetString("registry.hostname")+"/"+imageRef, c.nameOptions...)
+	ref, err := name.ParseReference(c.hostname+"/"+imageRef, c.nameOptions...)
 	if err != nil {
 		c.logger.Errorf("Error parsing image reference %s: %s", imageRef, err)
-		return
+		return err
 	}
 	// Get manifest so we have a digest to delete by
-	descr, err := c.puller.Get(ctx, ref)
+	descr, err := c.getPuller().Get(ctx, ref)
 	if err != nil {
 		c.logger.Errorf("Error fetching image reference %s: %s", imageRef, err)
-		return
+		return wrapError(err)
 	}
 	// Parse image reference by digest now
 	imageRefDigest := ref.Context().RepositoryStr() + "@" + descr.Digest.String()
-	ref, err = name.ParseReference(viper.GetString("registry.hostname")+"/"+imageRefDigest, c.nameOptions...)
+	ref, err = name.ParseReference(c.hostname+"/"+imageRefDigest, c.nameOptions...)
 	if err != nil {
 		c.logger.Errorf("Error parsing image reference %s: %s", imageRefDigest, err)
-		return
+		return err
 	}
 
 	// Delete tag using digest.
 	// Note, it will also delete any other tags pointing to the same digest!
-	err = c.pusher.Delete(ctx, ref)
+	err = c.getPusher().Delete(ctx, ref)
 	if err != nil {
 		c.logger.Errorf("Error deleting image %s: %s", imageRef, err)
-		return
+		return wrapError(err)
 	}
-	c.tagCountsMux.Lock()
-	c.tagCounts[repoPath]--
-	c.tagCountsMux.Unlock()
+	c.forgetTag(repoPath, tag)
+	// Recount as the other tags pointing to the same digest are gone too.
+	go c.ListTags(context.Background(), repoPath)
 	c.logger.Infof("Image %s has been successfully deleted.", imageRef)
+	return nil
+}
+
+// forgetTag update tag counts and caches after the tag is deleted.
+func (c *Client) forgetTag(repoPath, tag string) {
+	c.dropTag(repoPath, tag)
+	c.tagDetailsMux.Lock()
+	delete(c.tagDetails, repoPath+":"+tag)
+	c.tagDetailsMux.Unlock()
+	if c.cache != nil {
+		if err := c.cache.DeleteTag(c.name, repoPath, tag); err != nil {
+			c.logger.Errorf("Error deleting tag %s:%s from cache: %s", repoPath, tag, err)
+		}
+	}
+}
+
+// dropTag remove the tag from the tag counts and lists, return whether the tags of the repo are known.
+// The count is decreased only if the tag was listed, e.g. the delete event may be delivered again.
+func (c *Client) dropTag(repoPath, tag string) bool {
+	c.tagCountsMux.Lock()
+	defer c.tagCountsMux.Unlock()
+	known, ok := c.repoTags[repoPath]
+	if !ok {
+		return false
+	}
+	tags := []string{}
+	for _, t := range known {
+		if t != tag {
+			tags = append(tags, t)
+		}
+	}
+	if len(tags) < len(known) && c.tagCounts[repoPath] > 0 {
+		c.tagCounts[repoPath]--
+	}
+	c.repoTags[repoPath] = tags
+	return true
+}
+
+// GetTagAliases get the digest of the tag and all the tags of the repo pointing to it including the tag itself.
+// Those are the tags which disappear when the tag is deleted, so all of them are checked on the registry.
+func (c *Client) GetTagAliases(ctx context.Context, repoName, tag string) (string, []string, error) {
+	d, err := c.GetTagDetails(ctx, repoName, tag)
+	if err != nil {
+		return "", nil, err
+	}
+	digestTags, err := c.getDigestTags(ctx, repoName)
+	if err != nil {
+		return "", nil, err
+	}
+	aliases := append([]string{}, digestTags[d.Digest]...)
+	if !slices.Contains(aliases, tag) {
+		aliases = append(aliases, tag)
+	}
+	sort.Strings(aliases)
+	return d.Digest, aliases, nil
+}
+
+// getDigestTags get the tags of the repo per digest, all of them are checked on the registry.
+// Tags which cannot be checked are returned with the error.
+func (c *Client) getDigestTags(ctx context.Context, repoName string) (map[string][]string, error) {
+	tags, err := c.ListTags(ctx, repoName)
+	if err != nil {
+		return nil, err
+	}
+	digestTags := map[string][]string{}
+	details, errs := c.GetTagsDetails(ctx, repoName, tags)
+	for i, t := range details {
+		if errs[i] != nil {
+			return nil, fmt.Errorf("cannot get digest of tag %s: %w", tags[i], errs[i])
+		}
+		digestTags[t.Digest] = append(digestTags[t.Digest], t.Tag)
+	}
+	return digestTags, nil
+}
+
+// ApplyEvent update catalog and tag counts according to the registry notification event
+// without waiting for the next catalog refresh or tags counting.
+// Tag is a digest when the event is not related to a specific tag.
+func (c *Client) ApplyEvent(action, repo, tag string) {
+	isDigest := strings.HasPrefix(tag, "sha256:")
+	switch action {
+	case "push":
+		if c.addRepo(repo) {
+			c.logger.Infof("[ApplyEvent] New repo %s", repo)
+			if !isDigest {
+				c.tagCountsMux.Lock()
+				c.tagCounts[repo] = 1
+				c.tagCountsMux.Unlock()
+			}
+			if c.cache != nil {
+				if err := c.cache.SaveCatalog(c.name, c.GetRepos()); err != nil {
+					c.logger.Errorf("[ApplyEvent] Error saving catalog to cache: %s", err)
+				}
+			}
+		}
+		if isDigest {
+			// E.g. sub-images of the image index are pushed by digest before the index itself.
+			return
+		}
+	case "delete":
+		if !isDigest {
+			known := c.dropTag(repo, tag)
+			if c.cache != nil {
+				if err := c.cache.DeleteTag(c.name, repo, tag); err != nil {
+					c.logger.Errorf("[ApplyEvent] Error deleting tag %s:%s from cache: %s", repo, tag, err)
+				}
+			}
+			if known {
+				return
+			}
+		}
+	default:
+		return
+	}
+
+	// The pushed tag may already exist or the deleted digest may have any number of tags,
+	// so re-list tags of the repo in background.
+	go func() {
+		// Errors are logged by ListTags.
+		c.ListTags(context.Background(), repo)
+	}()
 }
@@ -0,0 +1,139 @@
+package registry
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/smartystreets/goconvey/convey"
+	"github.com/spf13/viper"
+)
+
+// newTestClient start an in-memory registry with the random images pushed to the tags of "app" repo,
+// the tags of the same group share the image.
+func newTestClient(t *testing.T, tagGroups ...[]string) *Client {
+	server := httptest.NewServer(ggcrregistry.New(ggcrregistry.Logger(log.New(io.Discard, "", 0))))
+	t.Cleanup(server.Close)
+	hostname := strings.TrimPrefix(server.URL, "http://")
+	for _, tags := range tagGroups {
+		img, err := random.Image(64, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, tag := range tags {
+			ref, err := name.NewTag(hostname+"/app:"+tag, name.Insecure)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := remote.Write(ref, img); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return NewClient(RegistryConfig{Name: "test", Hostname: hostname, Insecure: true, Username: "user", Password: "pass"}, nil)
+}
+
+func TestClientRecoversFromCanceledContext(t *testing.T) {
+	convey.Convey("Access the repo after the first call was canceled", t, func() {
+		c := newTestClient(t, []string{"v1"})
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := c.ListTags(ctx, "app")
+		convey.So(err, convey.ShouldWrap, context.Canceled)
+
+		tags, err := c.ListTags(context.Background(), "app")
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(tags, convey.ShouldResemble, []string{"v1"})
+
+		ctx, cancel = context.WithCancel(context.Background())
+		cancel()
+		_, err = c.GetTagDetails(ctx, "app", "v1")
+		convey.So(err, convey.ShouldNotBeNil)
+		d, err := c.GetTagDetails(context.Background(), "app", "v1")
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(d.Tag, convey.ShouldEqual, "v1")
+	})
+}
+
+func TestGetTagAliases(t *testing.T) {
+	convey.Convey("Get the tags sharing the digest checked on the registry", t, func() {
+		c := newTestClient(t, []string{"1", "2"}, []string{"3"})
+		digest, aliases, err := c.GetTagAliases(context.Background(), "app", "1")
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(aliases, convey.ShouldResemble, []string{"1", "2"})
+
+		d, err := c.GetTagDetails(context.Background(), "app", "2")
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(d.Digest, convey.ShouldEqual, digest)
+		_, aliases, err = c.GetTagAliases(context.Background(), "app", "3")
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(aliases, convey.ShouldResemble, []string{"3"})
+
+		// The details of the tag "2" are cached with the old digest.
+		img, err := random.Image(64, 1)
+		convey.So(err, convey.ShouldBeNil)
+		ref, err := name.NewTag(c.Hostname()+"/app:2", name.Insecure)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(remote.Write(ref, img), convey.ShouldBeNil)
+		_, aliases, err = c.GetTagAliases(context.Background(), "app", "1")
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(aliases, convey.ShouldResemble, []string{"1"})
+	})
+}
+
+func TestRefreshCatalogRetry(t *testing.T) {
+	convey.Convey("Retry the catalog refresh failed on the second page", t, func() {
+		failures := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case r.URL.Path != "/v2/_catalog":
+				w.WriteHeader(http.StatusOK)
+			case r.URL.Query().Get("last") == "":
+				w.Header().Set("Link", `</v2/_catalog?last=a&n=1>; rel="next"`)
+				w.Write([]byte(`{"repositories":["a"]}`))
+			case failures < 2:
+				failures++
+				w.WriteHeader(http.StatusBadRequest)
+			default:
+				w.Write([]byte(`{"repositories":["b"]}`))
+			}
+		}))
+		defer server.Close()
+		viper.Set("performance.catalog_page_size", 1)
+		defer viper.Set("performance.catalog_page_size", nil)
+		hostname := strings.TrimPrefix(server.URL, "http://")
+		c := NewClient(RegistryConfig{Name: "test", Hostname: hostname, Insecure: true, Username: "user", Password: "pass"}, nil)
+
+		for range 2 {
+			convey.So(c.RefreshCatalog(context.Background()), convey.ShouldNotBeNil)
+			convey.So(c.IsCatalogReady(), convey.ShouldBeFalse)
+			convey.So(c.GetRepos(), convey.ShouldResemble, []string{"a"})
+		}
+
+		convey.So(c.RefreshCatalog(context.Background()), convey.ShouldBeNil)
+		convey.So(c.IsCatalogReady(), convey.ShouldBeTrue)
+		convey.So(c.GetRepos(), convey.ShouldResemble, []string{"a", "b"})
+	})
+}
+
+func TestApplyDeleteEvent(t *testing.T) {
+	convey.Convey("Apply the delete event delivered twice", t, func() {
+		c := newTestClient(t, []string{"1"}, []string{"2"}, []string{"latest"})
+		_, err := c.ListTags(context.Background(), "app")
+		convey.So(err, convey.ShouldBeNil)
+
+		for range 2 {
+			c.ApplyEvent("delete", "app", "latest")
+			convey.So(c.tagCounts["app"], convey.ShouldEqual, 2)
+			convey.So(c.repoTags["app"], convey.ShouldResemble, []string{"1", "2"})
+		}
+	})
+}
@@ -0,0 +1,68 @@
+package registry
+
+import (
+	"fmt"
+
+	"github.com/spf13/viper"
+)
+
+// RegistryConfig registry endpoint and authentication.
+type RegistryConfig struct {
+	// Name is used in URLs and to switch between registries on UI, defaults to the hostname.
+	Name             string `mapstructure:"name"`
+	Hostname         string `mapstructure:"hostname"`
+	Insecure         bool   `mapstructure:"insecure"`
+	Username         string `mapstructure:"username"`
+	Password         string `mapstructure:"password"`
+	PasswordFile     string `mapstructure:"password_file"`
+	AuthWithKeychain bool   `mapstructure:"auth_with_keychain"`
+	// RequestsPerSecond limits the rate of API calls, defaults to performance.requests_per_second.
+	RequestsPerSecond float64 `mapstructure:"requests_per_second"`
+}
+
+// reservedNames names of UI pages under "/-/" which cannot be used as registry names.
+var reservedNames = []string{"compare", "import", "sbom", "search"}
+
+// ReadRegistryConfigs read the list of registries from the config.
+// When "registries" list is not defined, the single "registry" section is used.
+func ReadRegistryConfigs() ([]RegistryConfig, error) {
+	configs := []RegistryConfig{}
+	if viper.IsSet("registries") {
+		if err := viper.UnmarshalKey("registries", &configs); err != nil {
+			return nil, fmt.Errorf("cannot parse registries config: %w", err)
+		}
+	} else {
+		configs = append(configs, RegistryConfig{
+			Hostname:         viper.GetString("registry.hostname"),
+			Insecure:         viper.GetBool("registry.insecure"),
+			Username:         viper.GetString("registry.username"),
+			Password:         viper.GetString("registry.password"),
+			PasswordFile:     viper.GetString("registry.password_file"),
+			AuthWithKeychain: viper.GetBool("registry.auth_with_keychain"),
+		})
+	}
+	if len(configs) == 0 {
+		return nil, fmt.Errorf("no registries configured")
+	}
+
+	names := []string{}
+	for i := range configs {
+		if configs[i].Hostname == "" {
+			return nil, fmt.Errorf("registry #%d has no hostname configured", i+1)
+		}
+		if configs[i].Name == "" {
+			configs[i].Name = configs[i].Hostname
+		}
+		if configs[i].RequestsPerSecond == 0 {
+			configs[i].RequestsPerSecond = viper.GetFloat64("performance.requests_per_second")
+		}
+		if ItemInSlice(configs[i].Name, reservedNames) {
+			return nil, fmt.Errorf("registry name %s is reserved", configs[i].Name)
+		}
+		if ItemInSlice(configs[i].Name, names) {
+			return nil, fmt.Errorf("registry name %s is not unique", configs[i].Name)
+		}
+		names = append(names, configs[i].Name)
+	}
+	return configs, nil
+}
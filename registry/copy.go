@@ -0,0 +1,56 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+// ErrTagExists the target tag already points to another image.
+var ErrTagExists = errors.New("tag already exists")
+
+// CopyImage tag the image reference (repo:tag or repo@digest) as the target repo and tag, return the digest.
+// Within the same repo only the manifest is pushed, otherwise the image or the whole index is copied
+// with blobs mounted from the source repo where the registry allows it.
+// The target tag pointing to another image is not overwritten unless overwrite is set.
+func (c *Client) CopyImage(ctx context.Context, imageRef, targetRepo, targetTag string, overwrite bool) (string, error) {
+	ctx, cancel := withTimeout(ctx, c.timeouts.copyImage)
+	defer cancel()
+	ref, err := name.ParseReference(c.hostname+"/"+imageRef, c.nameOptions...)
+	if err != nil {
+		c.logger.Errorf("Error parsing image reference %s: %s", imageRef, err)
+		return "", err
+	}
+	targetRef := targetRepo + ":" + targetTag
+	target, err := name.NewTag(c.hostname+"/"+targetRef, c.nameOptions...)
+	if err != nil {
+		c.logger.Errorf("Error parsing image reference %s: %s", targetRef, err)
+		return "", err
+	}
+
+	descr, err := c.getPuller().Get(ctx, ref)
+	if err != nil {
+		c.logger.Errorf("Error fetching image reference %s: %s", imageRef, err)
+		return "", wrapError(err)
+	}
+	if !overwrite {
+		head, err := c.getPuller().Head(ctx, target)
+		if err == nil && head.Digest != descr.Digest {
+			return "", fmt.Errorf("%w: %s points to %s", ErrTagExists, targetRef, head.Digest)
+		}
+		if err != nil && !errors.Is(wrapError(err), ErrNotFound) {
+			c.logger.Errorf("Error fetching image reference %s: %s", targetRef, err)
+			return "", wrapError(err)
+		}
+	}
+
+	if err := c.getPusher().Push(ctx, target, descr); err != nil {
+		c.logger.Errorf("Error pushing %s to %s: %s", imageRef, targetRef, err)
+		return "", wrapError(err)
+	}
+	c.logger.Infof("Image %s has been successfully copied to %s.", imageRef, targetRef)
+	c.ApplyEvent("push", targetRepo, targetTag)
+	return descr.Digest.String(), nil
+}
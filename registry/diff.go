@@ -0,0 +1,295 @@
+package registry
+
+import (
+	"context"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// Annotations of buildkit attestation manifests in the image index.
+const (
+	referenceTypeAnnotation   = "vnd.docker.reference.type"
+	referenceDigestAnnotation = "vnd.docker.reference.digest"
+)
+
+// Status of the compared item.
+const (
+	DiffShared  = "shared"
+	DiffAdded   = "added"
+	DiffRemoved = "removed"
+	DiffChanged = "changed"
+)
+
+// ConfigChange difference of the image config field, Key is set for Env, Labels and ExposedPorts.
+type ConfigChange struct {
+	Field  string `json:"field"`
+	Key    string `json:"key,omitempty"`
+	Base   string `json:"base"`
+	Target string `json:"target"`
+	Status string `json:"status"`
+}
+
+// LayerChange layer of the base or the target image.
+type LayerChange struct {
+	LayerInfo
+	Status string `json:"status"`
+}
+
+// PlatformChange sub-image of the image index per platform.
+type PlatformChange struct {
+	Platform     string `json:"platform"`
+	BaseDigest   string `json:"baseDigest,omitempty"`
+	TargetDigest string `json:"targetDigest,omitempty"`
+	Status       string `json:"status"`
+}
+
+// FileChange file added, removed or changed by the layers which are not shared.
+type FileChange struct {
+	Path       string `json:"path"`
+	Status     string `json:"status"`
+	BaseSize   int64  `json:"baseSize"`
+	TargetSize int64  `json:"targetSize"`
+	BaseMode   string `json:"baseMode,omitempty"`
+	TargetMode string `json:"targetMode,omitempty"`
+}
+
+// ImageDiff differences of the target image from the base one.
+type ImageDiff struct {
+	Base        ImageInfo        `json:"base"`
+	Target      ImageInfo        `json:"target"`
+	Config      []ConfigChange   `json:"config"`
+	Layers      []LayerChange    `json:"layers"`
+	Platforms   []PlatformChange `json:"platforms"`
+	SharedSize  int64            `json:"sharedSize"`
+	AddedSize   int64            `json:"addedSize"`
+	RemovedSize int64            `json:"removedSize"`
+}
+
+// CompareImages compare two images of the repo, the references are tags or digests.
+func (c *Client) CompareImages(ctx context.Context, repoName, baseRef, targetRef string) (ImageDiff, error) {
+	base, err := c.GetImageInfo(ctx, repoImageRef(repoName, baseRef))
+	if err != nil {
+		return ImageDiff{}, err
+	}
+	target, err := c.GetImageInfo(ctx, repoImageRef(repoName, targetRef))
+	if err != nil {
+		return ImageDiff{}, err
+	}
+	return DiffImages(base, target), nil
+}
+
+// CompareLayerFiles compare files of the layers removed from the base image with the layers added to the target.
+// It returns whether any of the listings was truncated.
+func (c *Client) CompareLayerFiles(ctx context.Context, repoName string, diff ImageDiff, limit int) ([]FileChange, bool, error) {
+	truncated := false
+	listings := map[string][]LayerFiles{}
+	for _, l := range diff.Layers {
+		if l.Status == DiffShared {
+			continue
+		}
+		files, err := c.ListLayerFiles(ctx, repoName, l.Digest, limit)
+		if err != nil {
+			return nil, false, err
+		}
+		truncated = truncated || files.Truncated
+		listings[l.Status] = append(listings[l.Status], files)
+	}
+	return DiffFiles(listings[DiffRemoved], listings[DiffAdded]), truncated, nil
+}
+
+// DiffImages compare config and layers of two images or platforms of two image indexes.
+func DiffImages(base, target ImageInfo) ImageDiff {
+	diff := ImageDiff{Base: base, Target: target, Config: []ConfigChange{}, Layers: []LayerChange{}, Platforms: []PlatformChange{}}
+	if base.config != nil && target.config != nil {
+		b, t := base.config.Config, target.config.Config
+		diff.Config = append(diff.Config, diffMaps("Env", envToMap(b.Env), envToMap(t.Env))...)
+		diff.Config = append(diff.Config, diffValues("Entrypoint", strings.Join(b.Entrypoint, " "), strings.Join(t.Entrypoint, " "))...)
+		diff.Config = append(diff.Config, diffValues("Cmd", strings.Join(b.Cmd, " "), strings.Join(t.Cmd, " "))...)
+		diff.Config = append(diff.Config, diffValues("User", b.User, t.User)...)
+		diff.Config = append(diff.Config, diffValues("WorkingDir", b.WorkingDir, t.WorkingDir)...)
+		diff.Config = append(diff.Config, diffMaps("Labels", b.Labels, t.Labels)...)
+		diff.Config = append(diff.Config, diffMaps("ExposedPorts", setToMap(b.ExposedPorts), setToMap(t.ExposedPorts))...)
+	}
+
+	if base.IsImage && target.IsImage {
+		baseLayers := map[string]bool{}
+		for _, l := range base.Layers {
+			baseLayers[l.Digest] = true
+		}
+		targetLayers := map[string]bool{}
+		for _, l := range target.Layers {
+			targetLayers[l.Digest] = true
+			if baseLayers[l.Digest] {
+				diff.Layers = append(diff.Layers, LayerChange{LayerInfo: l, Status: DiffShared})
+				diff.SharedSize += l.Size
+			} else {
+				diff.Layers = append(diff.Layers, LayerChange{LayerInfo: l, Status: DiffAdded})
+				diff.AddedSize += l.Size
+			}
+		}
+		for _, l := range base.Layers {
+			if !targetLayers[l.Digest] {
+				diff.Layers = append(diff.Layers, LayerChange{LayerInfo: l, Status: DiffRemoved})
+				diff.RemovedSize += l.Size
+			}
+		}
+	}
+
+	if base.index != nil && target.index != nil {
+		b, t := indexDigests(base.index), indexDigests(target.index)
+		for _, p := range UniqueSortedSlice(append(SortedMapKeys(b), SortedMapKeys(t)...)) {
+			pc := PlatformChange{Platform: p, BaseDigest: b[p], TargetDigest: t[p]}
+			switch {
+			case pc.BaseDigest == "":
+				pc.Status = DiffAdded
+			case pc.TargetDigest == "":
+				pc.Status = DiffRemoved
+			case pc.BaseDigest != pc.TargetDigest:
+				pc.Status = DiffChanged
+			default:
+				pc.Status = DiffShared
+			}
+			diff.Platforms = append(diff.Platforms, pc)
+		}
+	}
+	return diff
+}
+
+// DiffFiles compare files of the base and target layers, applied in order. Directories are skipped
+// and files are considered changed when size or mode differ.
+func DiffFiles(base, target []LayerFiles) []FileChange {
+	b, t := mergeLayerFiles(base), mergeLayerFiles(target)
+	paths := append(SortedMapKeys(b), SortedMapKeys(t)...)
+	changes := []FileChange{}
+	for _, p := range UniqueSortedSlice(paths) {
+		bf, inBase := b[p]
+		tf, inTarget := t[p]
+		if inBase && bf.Whiteout {
+			// Deleted in the base, unknown whether it exists in the shared layers.
+			if !inTarget {
+				continue
+			}
+			inBase, bf = false, LayerFile{}
+		}
+		fc := FileChange{Path: p, BaseSize: bf.Size, TargetSize: tf.Size, BaseMode: bf.Mode, TargetMode: tf.Mode}
+		switch {
+		case inTarget && tf.Whiteout:
+			fc.Status = DiffRemoved
+			fc.TargetMode = ""
+		case !inTarget:
+			fc.Status = DiffRemoved
+		case !inBase:
+			fc.Status = DiffAdded
+		case bf.Size != tf.Size || bf.Mode != tf.Mode:
+			fc.Status = DiffChanged
+		default:
+			continue
+		}
+		changes = append(changes, fc)
+	}
+	return changes
+}
+
+// mergeLayerFiles files of the layers by path, the upper layers override the lower ones.
+func mergeLayerFiles(layers []LayerFiles) map[string]LayerFile {
+	files := map[string]LayerFile{}
+	for _, l := range layers {
+		for _, f := range l.Files {
+			if f.Opaque || strings.HasPrefix(f.Mode, "d") {
+				continue
+			}
+			if f.Whiteout {
+				if _, ok := files[f.Path]; ok {
+					// Deleted within the same set of layers.
+					delete(files, f.Path)
+					continue
+				}
+			}
+			files[f.Path] = f
+		}
+	}
+	return files
+}
+
+// diffValues compare single value of the config.
+func diffValues(field, base, target string) []ConfigChange {
+	if base == target {
+		return nil
+	}
+	return []ConfigChange{{Field: field, Base: base, Target: target, Status: changeStatus(base != "", target != "")}}
+}
+
+// diffMaps compare key-value pairs of the config.
+func diffMaps(field string, base, target map[string]string) []ConfigChange {
+	changes := []ConfigChange{}
+	for _, k := range UniqueSortedSlice(append(SortedMapKeys(base), SortedMapKeys(target)...)) {
+		b, inBase := base[k]
+		t, inTarget := target[k]
+		if inBase && inTarget && b == t {
+			continue
+		}
+		changes = append(changes, ConfigChange{Field: field, Key: k, Base: b, Target: t, Status: changeStatus(inBase, inTarget)})
+	}
+	return changes
+}
+
+func changeStatus(inBase, inTarget bool) string {
+	switch {
+	case !inBase:
+		return DiffAdded
+	case !inTarget:
+		return DiffRemoved
+	}
+	return DiffChanged
+}
+
+// envToMap convert the list of "KEY=value" to map.
+func envToMap(env []string) map[string]string {
+	res := map[string]string{}
+	for _, e := range env {
+		k, v, _ := strings.Cut(e, "=")
+		res[k] = v
+	}
+	return res
+}
+
+func setToMap(set map[string]struct{}) map[string]string {
+	res := map[string]string{}
+	for k := range set {
+		res[k] = ""
+	}
+	return res
+}
+
+// indexDigests digests of the index manifests by platform.
+// Attestation manifests of buildkit have unknown platform, so they are keyed by the platform of the image they refer to.
+// Other manifests of the same platform are keyed along with their digests, so none of them is dropped.
+func indexDigests(idx *v1.IndexManifest) map[string]string {
+	platforms := map[string]string{}
+	for _, m := range idx.Manifests {
+		platforms[m.Digest.String()] = getPlatform(m.Platform)
+	}
+	res := map[string]string{}
+	for _, m := range idx.Manifests {
+		key := getPlatform(m.Platform)
+		if m.Annotations[referenceTypeAnnotation] == "attestation-manifest" {
+			if p, ok := platforms[m.Annotations[referenceDigestAnnotation]]; ok {
+				key = p + " attestation"
+			}
+		}
+		if _, ok := res[key]; ok {
+			key += " " + m.Digest.String()
+		}
+		res[key] = m.Digest.String()
+	}
+	return res
+}
+
+// repoImageRef image reference of the repo by the tag or digest.
+func repoImageRef(repoName, ref string) string {
+	if strings.Contains(ref, ":") {
+		return repoName + "@" + ref
+	}
+	return repoName + ":" + ref
+}
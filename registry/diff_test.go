@@ -0,0 +1,121 @@
+package registry
+
+import (
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestDiffImages(t *testing.T) {
+	convey.Convey("Compare config and layers of two images", t, func() {
+		base := ImageInfo{
+			IsImage: true,
+			Layers:  []LayerInfo{{Digest: "sha256:a", Size: 10}, {Digest: "sha256:b", Size: 20}},
+			config: &v1.ConfigFile{Config: v1.Config{
+				Env:          []string{"PATH=/bin", "VERSION=1"},
+				Entrypoint:   []string{"/app"},
+				User:         "root",
+				Labels:       map[string]string{"team": "x"},
+				ExposedPorts: map[string]struct{}{"80/tcp": {}},
+			}},
+		}
+		target := ImageInfo{
+			IsImage: true,
+			Layers:  []LayerInfo{{Digest: "sha256:a", Size: 10}, {Digest: "sha256:c", Size: 30}},
+			config: &v1.ConfigFile{Config: v1.Config{
+				Env:          []string{"PATH=/bin", "VERSION=2", "DEBUG=1"},
+				Entrypoint:   []string{"/app"},
+				Labels:       map[string]string{"team": "x"},
+				ExposedPorts: map[string]struct{}{"443/tcp": {}},
+			}},
+		}
+		diff := DiffImages(base, target)
+		convey.So(diff.Config, convey.ShouldResemble, []ConfigChange{
+			{Field: "Env", Key: "DEBUG", Target: "1", Status: DiffAdded},
+			{Field: "Env", Key: "VERSION", Base: "1", Target: "2", Status: DiffChanged},
+			{Field: "User", Base: "root", Status: DiffRemoved},
+			{Field: "ExposedPorts", Key: "443/tcp", Status: DiffAdded},
+			{Field: "ExposedPorts", Key: "80/tcp", Status: DiffRemoved},
+		})
+		convey.So(len(diff.Layers), convey.ShouldEqual, 3)
+		convey.So(diff.Layers[0].Status, convey.ShouldEqual, DiffShared)
+		convey.So(diff.Layers[1].Status, convey.ShouldEqual, DiffAdded)
+		convey.So(diff.Layers[2].Digest, convey.ShouldEqual, "sha256:b")
+		convey.So(diff.Layers[2].Status, convey.ShouldEqual, DiffRemoved)
+		convey.So([]int64{diff.SharedSize, diff.AddedSize, diff.RemovedSize}, convey.ShouldResemble, []int64{10, 30, 20})
+	})
+
+	convey.Convey("Compare platforms of two image indexes", t, func() {
+		h1, _ := v1.NewHash("sha256:1111111111111111111111111111111111111111111111111111111111111111")
+		h2, _ := v1.NewHash("sha256:2222222222222222222222222222222222222222222222222222222222222222")
+		amd64 := &v1.Platform{OS: "linux", Architecture: "amd64"}
+		arm64 := &v1.Platform{OS: "linux", Architecture: "arm64"}
+		base := ImageInfo{IsImageIndex: true, index: &v1.IndexManifest{Manifests: []v1.Descriptor{{Digest: h1, Platform: amd64}}}}
+		target := ImageInfo{IsImageIndex: true, index: &v1.IndexManifest{Manifests: []v1.Descriptor{
+			{Digest: h2, Platform: amd64}, {Digest: h1, Platform: arm64},
+		}}}
+		diff := DiffImages(base, target)
+		convey.So(diff.Platforms, convey.ShouldResemble, []PlatformChange{
+			{Platform: "linux/amd64", BaseDigest: h1.String(), TargetDigest: h2.String(), Status: DiffChanged},
+			{Platform: "linux/arm64", TargetDigest: h1.String(), Status: DiffAdded},
+		})
+		convey.So(diff.Layers, convey.ShouldBeEmpty)
+	})
+
+	convey.Convey("Compare attestation manifests of two image indexes", t, func() {
+		h1, _ := v1.NewHash("sha256:1111111111111111111111111111111111111111111111111111111111111111")
+		h2, _ := v1.NewHash("sha256:2222222222222222222222222222222222222222222222222222222222222222")
+		h3, _ := v1.NewHash("sha256:3333333333333333333333333333333333333333333333333333333333333333")
+		h4, _ := v1.NewHash("sha256:4444444444444444444444444444444444444444444444444444444444444444")
+		unknown := &v1.Platform{OS: "unknown", Architecture: "unknown"}
+		attestation := func(h, ref v1.Hash) v1.Descriptor {
+			return v1.Descriptor{Digest: h, Platform: unknown, Annotations: map[string]string{
+				referenceTypeAnnotation: "attestation-manifest", referenceDigestAnnotation: ref.String()}}
+		}
+		base := ImageInfo{IsImageIndex: true, index: &v1.IndexManifest{Manifests: []v1.Descriptor{
+			{Digest: h1, Platform: &v1.Platform{OS: "linux", Architecture: "amd64"}},
+			{Digest: h2, Platform: &v1.Platform{OS: "linux", Architecture: "arm64"}},
+			attestation(h3, h1), attestation(h4, h2),
+		}}}
+		target := ImageInfo{IsImageIndex: true, index: &v1.IndexManifest{Manifests: []v1.Descriptor{
+			{Digest: h3, Platform: unknown}, {Digest: h4, Platform: unknown},
+		}}}
+		diff := DiffImages(base, target)
+		convey.So(diff.Platforms, convey.ShouldResemble, []PlatformChange{
+			{Platform: "linux/amd64", BaseDigest: h1.String(), Status: DiffRemoved},
+			{Platform: "linux/amd64 attestation", BaseDigest: h3.String(), Status: DiffRemoved},
+			{Platform: "linux/arm64", BaseDigest: h2.String(), Status: DiffRemoved},
+			{Platform: "linux/arm64 attestation", BaseDigest: h4.String(), Status: DiffRemoved},
+			{Platform: "unknown/unknown", TargetDigest: h3.String(), Status: DiffAdded},
+			{Platform: "unknown/unknown " + h4.String(), TargetDigest: h4.String(), Status: DiffAdded},
+		})
+	})
+}
+
+func TestDiffFiles(t *testing.T) {
+	convey.Convey("Compare files of the layers", t, func() {
+		base := []LayerFiles{{Files: []LayerFile{
+			{Path: "/etc/", Mode: "drwxr-xr-x"},
+			{Path: "/etc/app.conf", Size: 10, Mode: "-rw-r--r--"},
+			{Path: "/bin/app", Size: 100, Mode: "-rwxr-xr-x"},
+			{Path: "/tmp/cache", Size: 5, Mode: "-rw-r--r--"},
+		}}}
+		target := []LayerFiles{
+			{Files: []LayerFile{
+				{Path: "/etc/app.conf", Size: 10, Mode: "-rw-r--r--"},
+				{Path: "/bin/app", Size: 200, Mode: "-rwxr-xr-x"},
+				{Path: "/bin/tool", Size: 50, Mode: "-rwxr-xr-x"},
+			}},
+			{Files: []LayerFile{
+				{Path: "/bin/tool", Whiteout: true, Mode: "----------"},
+				{Path: "/var/log", Whiteout: true, Mode: "----------"},
+			}},
+		}
+		convey.So(DiffFiles(base, target), convey.ShouldResemble, []FileChange{
+			{Path: "/bin/app", Status: DiffChanged, BaseSize: 100, TargetSize: 200, BaseMode: "-rwxr-xr-x", TargetMode: "-rwxr-xr-x"},
+			{Path: "/tmp/cache", Status: DiffRemoved, BaseSize: 5, BaseMode: "-rw-r--r--"},
+			{Path: "/var/log", Status: DiffRemoved},
+		})
+	})
+}
@@ -0,0 +1,69 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+)
+
+// Typed errors returned by Client, check them with errors.Is.
+var (
+	ErrNotFound     = errors.New("not found")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrRateLimited  = errors.New("rate limited")
+)
+
+// wrapError classify the registry API error into one of the typed errors if possible.
+func wrapError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var terr *transport.Error
+	if !errors.As(err, &terr) {
+		return err
+	}
+
+	switch terr.StatusCode {
+	case http.StatusNotFound:
+		return fmt.Errorf("%w: %w", ErrNotFound, err)
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Errorf("%w: %w", ErrUnauthorized, err)
+	case http.StatusTooManyRequests:
+		return fmt.Errorf("%w: %w", ErrRateLimited, err)
+	}
+	// Some registries reply with non-standard status codes, so check the error codes too.
+	for _, d := range terr.Errors {
+		switch d.Code {
+		case transport.ManifestUnknownErrorCode, transport.NameUnknownErrorCode, transport.BlobUnknownErrorCode:
+			return fmt.Errorf("%w: %w", ErrNotFound, err)
+		case transport.UnauthorizedErrorCode, transport.DeniedErrorCode:
+			return fmt.Errorf("%w: %w", ErrUnauthorized, err)
+		case transport.TooManyRequestsErrorCode:
+			return fmt.Errorf("%w: %w", ErrRateLimited, err)
+		}
+	}
+	return err
+}
+
+// isUnsupported whether the registry reports the operation as unsupported, e.g. deleting a tag rather than digest:
+// 405 status code, UNSUPPORTED error code or 400 status code which is not classified as one of the typed errors.
+func isUnsupported(err error) bool {
+	var terr *transport.Error
+	if !errors.As(err, &terr) {
+		return false
+	}
+	for _, d := range terr.Errors {
+		if d.Code == transport.UnsupportedErrorCode {
+			return true
+		}
+	}
+	switch terr.StatusCode {
+	case http.StatusMethodNotAllowed:
+		return true
+	case http.StatusBadRequest:
+		return !errors.Is(err, ErrNotFound) && !errors.Is(err, ErrUnauthorized) && !errors.Is(err, ErrRateLimited)
+	}
+	return false
+}
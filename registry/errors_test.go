@@ -0,0 +1,37 @@
+package registry
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestWrapError(t *testing.T) {
+	convey.Convey("Classify registry errors", t, func() {
+		convey.So(wrapError(nil), convey.ShouldBeNil)
+		convey.So(errors.Is(wrapError(&transport.Error{StatusCode: http.StatusNotFound}), ErrNotFound), convey.ShouldBeTrue)
+		convey.So(errors.Is(wrapError(&transport.Error{StatusCode: http.StatusForbidden}), ErrUnauthorized), convey.ShouldBeTrue)
+		convey.So(errors.Is(wrapError(&transport.Error{StatusCode: http.StatusTooManyRequests}), ErrRateLimited), convey.ShouldBeTrue)
+		err := &transport.Error{StatusCode: http.StatusBadRequest, Errors: []transport.Diagnostic{{Code: transport.ManifestUnknownErrorCode}}}
+		convey.So(errors.Is(wrapError(err), ErrNotFound), convey.ShouldBeTrue)
+		other := errors.New("boom")
+		convey.So(wrapError(other), convey.ShouldEqual, other)
+	})
+}
+
+func TestIsUnsupported(t *testing.T) {
+	convey.Convey("Detect operations unsupported by the registry", t, func() {
+		convey.So(isUnsupported(wrapError(&transport.Error{StatusCode: http.StatusMethodNotAllowed})), convey.ShouldBeTrue)
+		convey.So(isUnsupported(wrapError(&transport.Error{StatusCode: http.StatusBadRequest})), convey.ShouldBeTrue)
+		err := &transport.Error{StatusCode: http.StatusForbidden, Errors: []transport.Diagnostic{{Code: transport.UnsupportedErrorCode}}}
+		convey.So(isUnsupported(wrapError(err)), convey.ShouldBeTrue)
+		err = &transport.Error{StatusCode: http.StatusBadRequest, Errors: []transport.Diagnostic{{Code: transport.ManifestUnknownErrorCode}}}
+		convey.So(isUnsupported(wrapError(err)), convey.ShouldBeFalse)
+		convey.So(isUnsupported(wrapError(&transport.Error{StatusCode: http.StatusNotFound})), convey.ShouldBeFalse)
+		convey.So(isUnsupported(wrapError(&transport.Error{StatusCode: http.StatusServiceUnavailable})), convey.ShouldBeFalse)
+		convey.So(isUnsupported(errors.New("boom")), convey.ShouldBeFalse)
+	})
+}
@@ -0,0 +1,286 @@
+package registry
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// Export formats.
+const (
+	// ExportOCI OCI image layout, the whole index is exported unless the platform is set.
+	ExportOCI = "oci"
+	// ExportDocker tarball for "docker load", single platform only.
+	ExportDocker = "docker"
+)
+
+// ErrPlatformRequired image index cannot be exported as docker tarball without the platform.
+var ErrPlatformRequired = errors.New("platform is required to export image index as docker tarball")
+
+// Export image or image index resolved for writing as a tarball.
+type Export struct {
+	Format string
+	// Filename suggested tarball file name.
+	Filename string
+	ref      name.Reference
+	img      v1.Image
+	idx      v1.ImageIndex
+}
+
+// NewExport resolve the image reference for export, for image index the platform like "linux/amd64" picks a single image.
+// Blobs are fetched while writing, so the context should be valid until Write is done.
+func (c *Client) NewExport(ctx context.Context, imageRef, format, platform string) (*Export, error) {
+	if format != ExportOCI && format != ExportDocker {
+		return nil, fmt.Errorf("unknown export format: %s", format)
+	}
+	ref, err := name.ParseReference(c.hostname+"/"+imageRef, c.nameOptions...)
+	if err != nil {
+		return nil, err
+	}
+	descr, err := c.getPuller().Get(ctx, ref)
+	if err != nil {
+		c.logger.Errorf("Error fetching image reference %s: %s", imageRef, err)
+		return nil, wrapError(err)
+	}
+
+	e := &Export{Format: format, ref: ref}
+	switch {
+	case descr.MediaType.IsImage():
+		if e.img, err = descr.Image(); err != nil {
+			return nil, wrapError(err)
+		}
+	case descr.MediaType.IsIndex():
+		idx, err := descr.ImageIndex()
+		if err != nil {
+			return nil, wrapError(err)
+		}
+		if platform == "" {
+			if format == ExportDocker {
+				return nil, ErrPlatformRequired
+			}
+			e.idx = idx
+			break
+		}
+		if e.img, err = platformImage(idx, platform); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("image reference %s is neither Index nor Image: %s", imageRef, descr.MediaType)
+	}
+
+	filename := strings.ReplaceAll(ref.Context().RepositoryStr(), "/", "_") + "_" + strings.TrimPrefix(ref.Identifier(), "sha256:")
+	if platform != "" {
+		filename += "_" + strings.ReplaceAll(platform, "/", "_")
+	}
+	e.Filename = filename + "." + format + ".tar"
+	return e, nil
+}
+
+// platformImage image of the index matching the platform.
+func platformImage(idx v1.ImageIndex, platform string) (v1.Image, error) {
+	p, err := v1.ParsePlatform(platform)
+	if err != nil {
+		return nil, err
+	}
+	idxMf, err := idx.IndexManifest()
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	for _, m := range idxMf.Manifests {
+		if m.MediaType.IsImage() && m.Platform != nil && m.Platform.Satisfies(*p) {
+			img, err := idx.Image(m.Digest)
+			return img, wrapError(err)
+		}
+	}
+	return nil, fmt.Errorf("%w: platform %s in the image index", ErrNotFound, platform)
+}
+
+// Write stream the tarball to w.
+func (e *Export) Write(w io.Writer) error {
+	if e.Format == ExportDocker {
+		return wrapError(tarball.Write(e.ref, e.img, w))
+	}
+
+	tw := tar.NewWriter(w)
+	ow := ociLayoutWriter{tw: tw, written: map[v1.Hash]bool{}}
+	if err := ow.writeFile("oci-layout", []byte(`{"imageLayoutVersion":"1.0.0"}`)); err != nil {
+		return err
+	}
+	var (
+		top v1.Descriptor
+		err error
+	)
+	if e.idx != nil {
+		top, err = ow.writeIndex(e.idx)
+	} else {
+		top, err = ow.writeImage(e.img)
+	}
+	if err != nil {
+		return wrapError(err)
+	}
+	if tag, ok := e.ref.(name.Tag); ok {
+		top.Annotations = map[string]string{"org.opencontainers.image.ref.name": tag.TagStr()}
+	}
+	index, _ := json.Marshal(v1.IndexManifest{SchemaVersion: 2, MediaType: types.OCIImageIndex, Manifests: []v1.Descriptor{top}})
+	if err := ow.writeFile("index.json", index); err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// ociLayoutWriter writer of the OCI image layout blobs into tar, each blob is written once.
+type ociLayoutWriter struct {
+	tw      *tar.Writer
+	written map[v1.Hash]bool
+}
+
+func (w *ociLayoutWriter) writeFile(path string, data []byte) error {
+	return w.writeEntry(path, bytes.NewReader(data), int64(len(data)))
+}
+
+func (w *ociLayoutWriter) writeEntry(path string, r io.Reader, size int64) error {
+	if err := w.tw.WriteHeader(&tar.Header{Name: path, Mode: 0o644, Size: size, Typeflag: tar.TypeReg}); err != nil {
+		return err
+	}
+	_, err := io.Copy(w.tw, r)
+	return err
+}
+
+func (w *ociLayoutWriter) writeBlob(digest v1.Hash, r io.Reader, size int64) error {
+	if w.written[digest] {
+		return nil
+	}
+	w.written[digest] = true
+	return w.writeEntry("blobs/"+digest.Algorithm+"/"+digest.Hex, r, size)
+}
+
+// writeIndex write the index with all its children.
+func (w *ociLayoutWriter) writeIndex(idx v1.ImageIndex) (v1.Descriptor, error) {
+	idxMf, err := idx.IndexManifest()
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+	for _, m := range idxMf.Manifests {
+		switch {
+		case m.MediaType.IsImage():
+			img, err := idx.Image(m.Digest)
+			if err != nil {
+				return v1.Descriptor{}, err
+			}
+			if _, err := w.writeImage(img); err != nil {
+				return v1.Descriptor{}, err
+			}
+		case m.MediaType.IsIndex():
+			child, err := idx.ImageIndex(m.Digest)
+			if err != nil {
+				return v1.Descriptor{}, err
+			}
+			if _, err := w.writeIndex(child); err != nil {
+				return v1.Descriptor{}, err
+			}
+		default:
+			// Neither image nor index, e.g. an artifact, its manifest is passed through as is.
+			wl, ok := idx.(withLayer)
+			if !ok {
+				return v1.Descriptor{}, fmt.Errorf("cannot export manifest %s of unsupported media type %s", m.Digest, m.MediaType)
+			}
+			l, err := wl.Layer(m.Digest)
+			if err != nil {
+				return v1.Descriptor{}, err
+			}
+			rc, err := l.Compressed()
+			if err != nil {
+				return v1.Descriptor{}, err
+			}
+			err = w.writeBlob(m.Digest, rc, m.Size)
+			rc.Close()
+			if err != nil {
+				return v1.Descriptor{}, err
+			}
+		}
+	}
+	return w.writeManifest(idx)
+}
+
+// withLayer the index which gives access to its children as blobs, e.g. the remote one.
+type withLayer interface {
+	Layer(v1.Hash) (v1.Layer, error)
+}
+
+// writeImage write the config, layers and manifest of the image.
+func (w *ociLayoutWriter) writeImage(img v1.Image) (v1.Descriptor, error) {
+	cfgName, err := img.ConfigName()
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+	cfg, err := img.RawConfigFile()
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+	if err := w.writeBlob(cfgName, bytes.NewReader(cfg), int64(len(cfg))); err != nil {
+		return v1.Descriptor{}, err
+	}
+	layers, err := img.Layers()
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+	for _, l := range layers {
+		digest, err := l.Digest()
+		if err != nil {
+			return v1.Descriptor{}, err
+		}
+		size, err := l.Size()
+		if err != nil {
+			return v1.Descriptor{}, err
+		}
+		if w.written[digest] {
+			continue
+		}
+		rc, err := l.Compressed()
+		if err != nil {
+			return v1.Descriptor{}, err
+		}
+		err = w.writeBlob(digest, rc, size)
+		rc.Close()
+		if err != nil {
+			return v1.Descriptor{}, err
+		}
+	}
+	return w.writeManifest(img)
+}
+
+// manifest image or index with the raw manifest.
+type manifest interface {
+	RawManifest() ([]byte, error)
+	MediaType() (types.MediaType, error)
+	Digest() (v1.Hash, error)
+}
+
+func (w *ociLayoutWriter) writeManifest(m manifest) (v1.Descriptor, error) {
+	raw, err := m.RawManifest()
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+	mt, err := m.MediaType()
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+	digest, err := m.Digest()
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+	if err := w.writeBlob(digest, bytes.NewReader(raw), int64(len(raw))); err != nil {
+		return v1.Descriptor{}, err
+	}
+	return v1.Descriptor{MediaType: mt, Size: int64(len(raw)), Digest: digest}, nil
+}
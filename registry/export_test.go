@@ -0,0 +1,74 @@
+package registry
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestExportOCILayout(t *testing.T) {
+	convey.Convey("Write image index as OCI image layout tar", t, func() {
+		img1, _ := random.Image(100, 2)
+		img2, _ := random.Image(100, 1)
+		// Neither image nor index, passed through as is.
+		artifact := static.NewLayer([]byte(`{"artifact":true}`), "application/vnd.example.artifact+json")
+		// The same image twice, its blobs are written once.
+		idx := mutate.AppendManifests(empty.Index,
+			mutate.IndexAddendum{Add: img1, Descriptor: v1.Descriptor{Platform: &v1.Platform{OS: "linux", Architecture: "amd64"}}},
+			mutate.IndexAddendum{Add: img2, Descriptor: v1.Descriptor{Platform: &v1.Platform{OS: "linux", Architecture: "arm64"}}},
+			mutate.IndexAddendum{Add: img1, Descriptor: v1.Descriptor{Platform: &v1.Platform{OS: "linux", Architecture: "386"}}},
+			mutate.IndexAddendum{Add: artifact},
+		)
+		ref, _ := name.ParseReference("example.com/a/b:1")
+
+		var buf bytes.Buffer
+		e := &Export{Format: ExportOCI, ref: ref, idx: idx}
+		convey.So(e.Write(&buf), convey.ShouldBeNil)
+
+		files := map[string][]byte{}
+		tr := tar.NewReader(&buf)
+		for {
+			h, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(files, convey.ShouldNotContainKey, h.Name)
+			files[h.Name], _ = io.ReadAll(tr)
+		}
+		// oci-layout, index.json, 2 manifests, 2 configs, 3 layers, the artifact and the index itself.
+		convey.So(len(files), convey.ShouldEqual, 11)
+		artifactDigest, _ := artifact.Digest()
+		convey.So(string(files["blobs/sha256/"+artifactDigest.Hex]), convey.ShouldEqual, `{"artifact":true}`)
+		convey.So(string(files["oci-layout"]), convey.ShouldEqual, `{"imageLayoutVersion":"1.0.0"}`)
+
+		var index v1.IndexManifest
+		convey.So(json.Unmarshal(files["index.json"], &index), convey.ShouldBeNil)
+		digest, _ := idx.Digest()
+		convey.So(index.Manifests, convey.ShouldHaveLength, 1)
+		convey.So(index.Manifests[0].Digest, convey.ShouldEqual, digest)
+		convey.So(index.Manifests[0].Annotations["org.opencontainers.image.ref.name"], convey.ShouldEqual, "1")
+		convey.So(files, convey.ShouldContainKey, "blobs/sha256/"+digest.Hex)
+
+		convey.Convey("Pick image of the index by platform", func() {
+			img, err := platformImage(idx, "linux/arm64")
+			convey.So(err, convey.ShouldBeNil)
+			d1, _ := img.Digest()
+			d2, _ := img2.Digest()
+			convey.So(d1, convey.ShouldEqual, d2)
+
+			_, err = platformImage(idx, "windows/amd64")
+			convey.So(err, convey.ShouldWrap, ErrNotFound)
+		})
+	})
+}
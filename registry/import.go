@@ -0,0 +1,303 @@
+package registry
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+)
+
+// Import job statuses.
+const (
+	ImportRunning = "running"
+	ImportDone    = "done"
+	ImportFailed  = "failed"
+)
+
+// importJobRetention how long the finished import jobs are kept to report their status.
+const importJobRetention = time.Hour
+
+// ErrInvalidTarball the uploaded file is neither docker nor OCI image layout tarball.
+var ErrInvalidTarball = errors.New("invalid image tarball")
+
+// ErrUploadTooLarge the uploaded tarball exceeds the size limit.
+var ErrUploadTooLarge = errors.New("image tarball is too large")
+
+// ociBlobRegexp allowed paths of the blobs in OCI image layout.
+var ociBlobRegexp = regexp.MustCompile(`^blobs/[a-z0-9]+/[a-f0-9]+$`)
+
+// ImportJob progress of pushing the uploaded tarball to the registry.
+type ImportJob struct {
+	ID     string `json:"id"`
+	Repo   string `json:"repo"`
+	Tag    string `json:"tag"`
+	Format string `json:"format"`
+	Status string `json:"status"`
+	// Complete and Total bytes of the blobs to push, the blobs already existing in the registry are not counted.
+	Complete int64     `json:"complete"`
+	Total    int64     `json:"total"`
+	Digest   string    `json:"digest"`
+	Error    string    `json:"error,omitempty"`
+	Started  time.Time `json:"started"`
+	finished time.Time
+}
+
+// SaveUpload save the uploaded tarball to a temporary file, gzip-compressed one is decompressed.
+// The size limit in bytes applies to the decompressed tarball, if set to 0 there is no limit.
+func SaveUpload(r io.Reader, limit int64) (string, error) {
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return "", fmt.Errorf("%w: %w", ErrInvalidTarball, err)
+		}
+		defer gz.Close()
+		r = gz
+	} else {
+		r = br
+	}
+
+	f, err := os.CreateTemp("", "registry-ui-import-*.tar")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if limit > 0 {
+		r = io.LimitReader(r, limit+1)
+	}
+	n, err := io.Copy(f, r)
+	if err == nil && limit > 0 && n > limit {
+		err = fmt.Errorf("%w: the limit is %s", ErrUploadTooLarge, PrettySize(float64(limit)))
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// StartImport push the docker or OCI image layout tarball to the repo and tag in background.
+// The tarball is checked before returning, it is removed when the import is finished or failed to start.
+func (c *Client) StartImport(tarPath, repoPath, tag string) (ImportJob, error) {
+	cleanup := func() { os.Remove(tarPath) }
+	ref, err := name.NewTag(c.hostname+"/"+repoPath+":"+tag, c.nameOptions...)
+	if err != nil {
+		cleanup()
+		return ImportJob{}, err
+	}
+
+	var (
+		t      remote.Taggable
+		digest v1.Hash
+		format = ExportDocker
+	)
+	isDocker, isOCI, err := tarballFormat(tarPath)
+	switch {
+	case err != nil:
+		cleanup()
+		return ImportJob{}, fmt.Errorf("%w: %w", ErrInvalidTarball, err)
+	case isDocker:
+		// Prefer docker format as "docker save" may add OCI index referencing the platforms which are not saved.
+		img, err := tarball.ImageFromPath(tarPath, nil)
+		if err == nil {
+			digest, err = img.Digest()
+		}
+		if err != nil {
+			cleanup()
+			return ImportJob{}, fmt.Errorf("%w: %w", ErrInvalidTarball, err)
+		}
+		t = img
+	case isOCI:
+		format = ExportOCI
+		dir, err := os.MkdirTemp("", "registry-ui-import-*")
+		if err == nil {
+			err = extractOCILayout(tarPath, dir)
+		}
+		cleanup()
+		cleanup = func() { os.RemoveAll(dir) }
+		if err == nil {
+			t, digest, err = ociLayoutTaggable(dir)
+		}
+		if err != nil {
+			cleanup()
+			return ImportJob{}, fmt.Errorf("%w: %w", ErrInvalidTarball, err)
+		}
+	default:
+		cleanup()
+		return ImportJob{}, fmt.Errorf("%w: neither manifest.json nor oci-layout found", ErrInvalidTarball)
+	}
+
+	id := make([]byte, 8)
+	rand.Read(id)
+	job := &ImportJob{ID: hex.EncodeToString(id), Repo: repoPath, Tag: tag, Format: format, Status: ImportRunning,
+		Digest: digest.String(), Started: time.Now()}
+	c.importsMux.Lock()
+	for id, j := range c.imports {
+		if !j.finished.IsZero() && time.Since(j.finished) > importJobRetention {
+			delete(c.imports, id)
+		}
+	}
+	c.imports[job.ID] = job
+	// Copy before starting the push which updates the job.
+	res := *job
+	c.importsMux.Unlock()
+	c.logger.Infof("Importing %s tarball as %s:%s (%s).", format, repoPath, tag, job.Digest)
+
+	go func() {
+		defer cleanup()
+		ctx, cancel := withTimeout(context.Background(), c.timeouts.copyImage)
+		defer cancel()
+		updates := make(chan v1.Update, 16)
+		errCh := make(chan error, 1)
+		go func() {
+			errCh <- remote.Push(ref, t, append(c.pushOptions, remote.WithContext(ctx), remote.WithProgress(updates))...)
+		}()
+		// The channel is closed when the push is finished.
+		for u := range updates {
+			if u.Error == nil {
+				c.importsMux.Lock()
+				job.Complete, job.Total = u.Complete, u.Total
+				c.importsMux.Unlock()
+			}
+		}
+		err := <-errCh
+
+		c.importsMux.Lock()
+		job.finished = time.Now()
+		job.Status = ImportDone
+		if err == nil {
+			// Progress is not reported for the blobs mounted or found in the registry.
+			job.Complete = job.Total
+		} else {
+			job.Status = ImportFailed
+			job.Error = wrapError(err).Error()
+		}
+		c.importsMux.Unlock()
+		if err != nil {
+			c.logger.Errorf("Error importing tarball as %s:%s: %s", repoPath, tag, err)
+			return
+		}
+		c.logger.Infof("Tarball has been successfully imported as %s:%s.", repoPath, tag)
+		c.ApplyEvent("push", repoPath, tag)
+	}()
+	return res, nil
+}
+
+// GetImport get the import job by ID.
+func (c *Client) GetImport(id string) (ImportJob, bool) {
+	c.importsMux.Lock()
+	defer c.importsMux.Unlock()
+	job, ok := c.imports[id]
+	if !ok {
+		return ImportJob{}, false
+	}
+	return *job, true
+}
+
+// tarballFormat whether the tarball is docker one with manifest.json and whether it is OCI image layout.
+func tarballFormat(tarPath string) (bool, bool, error) {
+	f, err := os.Open(tarPath)
+	if err != nil {
+		return false, false, err
+	}
+	defer f.Close()
+
+	isDocker, isOCI := false, false
+	tr := tar.NewReader(f)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return false, false, err
+		}
+		switch path.Clean(h.Name) {
+		case "manifest.json":
+			isDocker = true
+		case "oci-layout":
+			isOCI = true
+		}
+	}
+	return isDocker, isOCI, nil
+}
+
+// extractOCILayout extract the layout files from the tarball to the directory, other entries are skipped.
+func extractOCILayout(tarPath, dir string) error {
+	f, err := os.Open(tarPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	tr := tar.NewReader(f)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		p := path.Clean(h.Name)
+		if h.Typeflag != tar.TypeReg || (p != "oci-layout" && p != "index.json" && !ociBlobRegexp.MatchString(p)) {
+			continue
+		}
+		dst := filepath.Join(dir, filepath.FromSlash(p))
+		if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+			return err
+		}
+		out, err := os.Create(dst)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(out, tr)
+		out.Close()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// ociLayoutTaggable image or index to push from the OCI image layout directory.
+// The single manifest of the layout is pushed as is, otherwise the layout index with all of them.
+func ociLayoutTaggable(dir string) (remote.Taggable, v1.Hash, error) {
+	idx, err := layout.ImageIndexFromPath(dir)
+	if err != nil {
+		return nil, v1.Hash{}, err
+	}
+	idxMf, err := idx.IndexManifest()
+	if err != nil {
+		return nil, v1.Hash{}, err
+	}
+	if len(idxMf.Manifests) != 1 {
+		digest, err := idx.Digest()
+		return idx, digest, err
+	}
+	m := idxMf.Manifests[0]
+	switch {
+	case m.MediaType.IsImage():
+		img, err := idx.Image(m.Digest)
+		return img, m.Digest, err
+	case m.MediaType.IsIndex():
+		child, err := idx.ImageIndex(m.Digest)
+		return child, m.Digest, err
+	}
+	return nil, v1.Hash{}, fmt.Errorf("unsupported media type %s", m.MediaType)
+}
@@ -0,0 +1,72 @@
+package registry
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestImportOCILayout(t *testing.T) {
+	convey.Convey("Read OCI image layout from the uploaded tarball", t, func() {
+		img, _ := random.Image(100, 2)
+		ref, _ := name.ParseReference("example.com/a/b:1")
+
+		var gz bytes.Buffer
+		zw := gzip.NewWriter(&gz)
+		// Entries outside of the layout are skipped on extraction.
+		tw := tar.NewWriter(zw)
+		tw.WriteHeader(&tar.Header{Name: "../evil", Mode: 0o644, Size: 4, Typeflag: tar.TypeReg})
+		tw.Write([]byte("evil"))
+		tw.Flush()
+		e := &Export{Format: ExportOCI, ref: ref, img: img}
+		convey.So(e.Write(zw), convey.ShouldBeNil)
+		zw.Close()
+		tarPath, err := SaveUpload(&gz, 0)
+		convey.So(err, convey.ShouldBeNil)
+		defer os.Remove(tarPath)
+
+		isDocker, isOCI, err := tarballFormat(tarPath)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(isDocker, convey.ShouldBeFalse)
+		convey.So(isOCI, convey.ShouldBeTrue)
+
+		dir := t.TempDir()
+		convey.So(extractOCILayout(tarPath, filepath.Join(dir, "layout")), convey.ShouldBeNil)
+		_, err = os.Stat(filepath.Join(dir, "evil"))
+		convey.So(os.IsNotExist(err), convey.ShouldBeTrue)
+
+		taggable, digest, err := ociLayoutTaggable(filepath.Join(dir, "layout"))
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(taggable, convey.ShouldNotBeNil)
+		want, _ := img.Digest()
+		convey.So(digest, convey.ShouldEqual, want)
+	})
+
+	convey.Convey("Reject the file which is not a tarball", t, func() {
+		tarPath, err := SaveUpload(bytes.NewReader([]byte("not a tarball")), 0)
+		convey.So(err, convey.ShouldBeNil)
+		defer os.Remove(tarPath)
+		_, _, err = tarballFormat(tarPath)
+		convey.So(err, convey.ShouldNotBeNil)
+	})
+
+	convey.Convey("Reject the upload exceeding the size limit after decompression", t, func() {
+		var gz bytes.Buffer
+		zw := gzip.NewWriter(&gz)
+		zw.Write(make([]byte, 2048))
+		zw.Close()
+		_, err := SaveUpload(bytes.NewReader(gz.Bytes()), 1024)
+		convey.So(err, convey.ShouldWrap, ErrUploadTooLarge)
+
+		tarPath, err := SaveUpload(bytes.NewReader(gz.Bytes()), 2048)
+		convey.So(err, convey.ShouldBeNil)
+		os.Remove(tarPath)
+	})
+}
@@ -0,0 +1,180 @@
+package registry
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"go.yaml.in/yaml/v3"
+)
+
+// InUseImage image reference in use and where it is found.
+type InUseImage struct {
+	Ref string
+	// Source file and the Kubernetes object or line number referencing the image.
+	Source string
+}
+
+// ReadInUseImages read the image references in use from the file or the directory of files.
+// JSON and YAML files are Kubernetes manifests or "kubectl get -o json|yaml" dumps, all "image" and "imageID" fields
+// of the objects are collected. Other files are plain lists of image references, one per line.
+func ReadInUseImages(path string) ([]InUseImage, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return readInUseFile(path)
+	}
+
+	images := []InUseImage{}
+	err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		switch strings.ToLower(filepath.Ext(p)) {
+		case ".json", ".yaml", ".yml", ".txt":
+			res, err := readInUseFile(p)
+			if err != nil {
+				return err
+			}
+			images = append(images, res...)
+		}
+		return nil
+	})
+	return images, err
+}
+
+// readInUseFile read the image references from a single file by its extension.
+func readInUseFile(path string) ([]InUseImage, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	images := []InUseImage{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json", ".yaml", ".yml":
+		// JSON is valid YAML, multiple YAML documents are separated by "---".
+		dec := yaml.NewDecoder(f)
+		for {
+			var doc interface{}
+			err := dec.Decode(&doc)
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("cannot parse %s: %w", path, err)
+			}
+			collectImages(doc, path, "", &images)
+		}
+	default:
+		scanner := bufio.NewScanner(f)
+		for n := 1; scanner.Scan(); n++ {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			images = append(images, InUseImage{Ref: line, Source: fmt.Sprintf("%s:%d", path, n)})
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return images, nil
+}
+
+// collectImages walk the Kubernetes object collecting the image fields, the owner is the closest object with kind.
+func collectImages(node interface{}, file, owner string, images *[]InUseImage) {
+	switch v := node.(type) {
+	case map[string]interface{}:
+		if kind, ok := v["kind"].(string); ok {
+			if meta, ok := v["metadata"].(map[string]interface{}); ok {
+				obj, _ := meta["name"].(string)
+				if ns, ok := meta["namespace"].(string); ok && ns != "" {
+					obj = ns + "/" + obj
+				}
+				owner = kind + "/" + obj
+			}
+		}
+		for key, value := range v {
+			if s, ok := value.(string); ok && (key == "image" || key == "imageID") && s != "" {
+				source := file
+				if owner != "" {
+					source += " " + owner
+				}
+				*images = append(*images, InUseImage{Ref: s, Source: source})
+				continue
+			}
+			collectImages(value, file, owner, images)
+		}
+	case []interface{}:
+		for _, value := range v {
+			collectImages(value, file, owner, images)
+		}
+	}
+}
+
+// ResolveInUseDigests resolve the image references of this registry to digests, only the given repos are resolved.
+// Return repo -> digest -> sources of the image references. Tags which do not exist are skipped.
+func (c *Client) ResolveInUseDigests(ctx context.Context, images []InUseImage, repos []string) (map[string]map[string][]string, error) {
+	inUse := map[string]map[string][]string{}
+	registry, err := name.NewRegistry(c.hostname, c.nameOptions...)
+	if err != nil {
+		return nil, err
+	}
+	// Digests of the tags already resolved, empty for the ones not found.
+	resolved := map[string]string{}
+	for _, image := range images {
+		// The runtime prefix of the container status imageID, e.g. docker-pullable://
+		_, ref, found := strings.Cut(image.Ref, "://")
+		if !found {
+			ref = image.Ref
+		}
+		r, err := name.ParseReference(ref, c.nameOptions...)
+		if err != nil || r.Context().RegistryStr() != registry.RegistryStr() {
+			continue
+		}
+		repo := r.Context().RepositoryStr()
+		if !ItemInSlice(repo, repos) {
+			continue
+		}
+
+		digest := r.Identifier()
+		if tag, ok := r.(name.Tag); ok {
+			if digest, ok = resolved[r.String()]; !ok {
+				details, err := c.GetTagDetails(ctx, repo, tag.TagStr())
+				if errors.Is(err, ErrNotFound) {
+					c.logger.Warnf("Image %s in use by %s is not found", image.Ref, image.Source)
+					resolved[r.String()] = ""
+					continue
+				}
+				if err != nil {
+					return nil, fmt.Errorf("cannot resolve image %s in use by %s: %w", image.Ref, image.Source, err)
+				}
+				digest = details.Digest
+				resolved[r.String()] = digest
+			}
+			if digest == "" {
+				continue
+			}
+		}
+
+		if inUse[repo] == nil {
+			inUse[repo] = map[string][]string{}
+		}
+		source := image.Source + " (" + image.Ref + ")"
+		if !ItemInSlice(source, inUse[repo][digest]) {
+			inUse[repo][digest] = append(inUse[repo][digest], source)
+		}
+	}
+	return inUse, nil
+}
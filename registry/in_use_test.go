@@ -0,0 +1,92 @@
+package registry
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+const testPodsJSON = `{
+  "apiVersion": "v1",
+  "kind": "List",
+  "items": [{
+    "apiVersion": "v1",
+    "kind": "Pod",
+    "metadata": {"name": "app-1", "namespace": "prod"},
+    "spec": {
+      "initContainers": [{"name": "init", "image": "registry.example.com/team/init:1.0"}],
+      "containers": [{"name": "app", "image": "registry.example.com/team/app:2.1"}]
+    },
+    "status": {
+      "containerStatuses": [{"name": "app", "image": "registry.example.com/team/app:2.1",
+        "imageID": "docker-pullable://registry.example.com/team/app@sha256:0000000000000000000000000000000000000000000000000000000000000001"}]
+    }
+  }]
+}`
+
+const testDeploymentYAML = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    metadata:
+      labels:
+        app: web
+    spec:
+      containers:
+        - name: web
+          image: registry.example.com/team/web:3
+---
+apiVersion: batch/v1
+kind: CronJob
+metadata:
+  name: cleanup
+  namespace: ops
+spec:
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          containers:
+            - name: cleanup
+              image: busybox
+`
+
+func TestReadInUseImages(t *testing.T) {
+	convey.Convey("Read images in use from Kubernetes manifests and plain lists", t, func() {
+		dir := t.TempDir()
+		os.WriteFile(filepath.Join(dir, "pods.json"), []byte(testPodsJSON), 0o644)
+		os.MkdirAll(filepath.Join(dir, "manifests"), 0o755)
+		os.WriteFile(filepath.Join(dir, "manifests", "web.yaml"), []byte(testDeploymentYAML), 0o644)
+		os.WriteFile(filepath.Join(dir, "images.txt"), []byte("# pinned\nregistry.example.com/team/tool:5\n\n"), 0o644)
+		os.WriteFile(filepath.Join(dir, "README.md"), []byte("image: registry.example.com/team/doc:1"), 0o644)
+
+		images, err := ReadInUseImages(dir)
+		convey.So(err, convey.ShouldBeNil)
+		res := []string{}
+		for _, i := range images {
+			res = append(res, i.Ref+" "+i.Source)
+		}
+		sort.Strings(res)
+		convey.So(res, convey.ShouldResemble, []string{
+			"busybox " + filepath.Join(dir, "manifests", "web.yaml") + " CronJob/ops/cleanup",
+			"docker-pullable://registry.example.com/team/app@sha256:0000000000000000000000000000000000000000000000000000000000000001 " +
+				filepath.Join(dir, "pods.json") + " Pod/prod/app-1",
+			"registry.example.com/team/app:2.1 " + filepath.Join(dir, "pods.json") + " Pod/prod/app-1",
+			"registry.example.com/team/app:2.1 " + filepath.Join(dir, "pods.json") + " Pod/prod/app-1",
+			"registry.example.com/team/init:1.0 " + filepath.Join(dir, "pods.json") + " Pod/prod/app-1",
+			"registry.example.com/team/tool:5 " + filepath.Join(dir, "images.txt") + ":2",
+			"registry.example.com/team/web:3 " + filepath.Join(dir, "manifests", "web.yaml") + " Deployment/web",
+		})
+
+		_, err = ReadInUseImages(filepath.Join(dir, "missing.json"))
+		convey.So(err, convey.ShouldNotBeNil)
+		os.WriteFile(filepath.Join(dir, "broken.yaml"), []byte("a: [b"), 0o644)
+		_, err = ReadInUseImages(dir)
+		convey.So(err, convey.ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,135 @@
+package registry
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// Whiteout file prefixes of the OCI image layer spec.
+const (
+	whiteoutPrefix = ".wh."
+	whiteoutOpaque = ".wh..wh..opq"
+)
+
+// LayerInfo image layer with the matching history entry of the config file.
+type LayerInfo struct {
+	Digest    string    `json:"digest"`
+	Size      int64     `json:"size"`
+	MediaType string    `json:"mediaType"`
+	DiffID    string    `json:"diffID,omitempty"`
+	CreatedBy string    `json:"createdBy,omitempty"`
+	Comment   string    `json:"comment,omitempty"`
+	Created   time.Time `json:"created,omitempty"`
+}
+
+// LayerFile entry of the layer tar.
+type LayerFile struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+	Mode string `json:"mode"`
+	// Link target of symlinks and hardlinks.
+	Link string `json:"link,omitempty"`
+	// Whiteout marks the path as deleted from the lower layers, Path is the deleted path then.
+	Whiteout bool `json:"whiteout,omitempty"`
+	// Opaque whiteout hides all the content of the directory from the lower layers.
+	Opaque bool `json:"opaque,omitempty"`
+}
+
+// LayerFiles file listing of the layer.
+type LayerFiles struct {
+	Digest    string      `json:"digest"`
+	Files     []LayerFile `json:"files"`
+	TotalSize int64       `json:"totalSize"`
+	// Truncated is set when the listing is cut at the limit of files.
+	Truncated bool `json:"truncated"`
+}
+
+// imageLayers list layers of the image manifest matching them with non-empty history entries of the config.
+func imageLayers(mf *v1.Manifest, cfg *v1.ConfigFile) []LayerInfo {
+	history := []v1.History{}
+	for _, h := range cfg.History {
+		if !h.EmptyLayer {
+			history = append(history, h)
+		}
+	}
+	layers := []LayerInfo{}
+	for i, l := range mf.Layers {
+		layer := LayerInfo{Digest: l.Digest.String(), Size: l.Size, MediaType: string(l.MediaType)}
+		if i < len(cfg.RootFS.DiffIDs) {
+			layer.DiffID = cfg.RootFS.DiffIDs[i].String()
+		}
+		// History is optional and may be inconsistent, match it only when counts agree.
+		if len(history) == len(mf.Layers) {
+			layer.CreatedBy = history[i].CreatedBy
+			layer.Comment = history[i].Comment
+			layer.Created = history[i].Created.Time
+		}
+		layers = append(layers, layer)
+	}
+	return layers
+}
+
+// ListLayerFiles stream the layer blob and list files of its tar up to the limit.
+func (c *Client) ListLayerFiles(ctx context.Context, repoName, digest string, limit int) (LayerFiles, error) {
+	ctx, cancel := withTimeout(ctx, c.timeouts.layerFiles)
+	defer cancel()
+	ref, err := name.NewDigest(c.hostname+"/"+repoName+"@"+digest, c.nameOptions...)
+	if err != nil {
+		return LayerFiles{}, err
+	}
+	layer, err := c.getPuller().Layer(ctx, ref)
+	if err != nil {
+		c.logger.Errorf("Error fetching layer %s: %s", ref, err)
+		return LayerFiles{}, wrapError(err)
+	}
+	rc, err := layer.Uncompressed()
+	if err != nil {
+		c.logger.Errorf("Error reading layer %s: %s", ref, err)
+		return LayerFiles{}, wrapError(err)
+	}
+	defer rc.Close()
+
+	res := LayerFiles{Digest: digest, Files: []LayerFile{}}
+	tr := tar.NewReader(rc)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			c.logger.Errorf("Error reading tar of layer %s: %s", ref, err)
+			return LayerFiles{}, wrapError(err)
+		}
+		if limit > 0 && len(res.Files) >= limit {
+			res.Truncated = true
+			break
+		}
+		f := LayerFile{
+			Path: "/" + strings.TrimPrefix(path.Clean("/"+hdr.Name), "/"),
+			Size: hdr.Size,
+			Mode: hdr.FileInfo().Mode().String(),
+		}
+		if hdr.Typeflag == tar.TypeSymlink || hdr.Typeflag == tar.TypeLink {
+			f.Link = hdr.Linkname
+		}
+		dir, base := path.Split(f.Path)
+		if base == whiteoutOpaque {
+			f.Path = dir
+			f.Opaque = true
+		} else if strings.HasPrefix(base, whiteoutPrefix) {
+			f.Path = dir + strings.TrimPrefix(base, whiteoutPrefix)
+			f.Whiteout = true
+		}
+		res.TotalSize += f.Size
+		res.Files = append(res.Files, f)
+	}
+	return res, nil
+}
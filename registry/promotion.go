@@ -0,0 +1,135 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/spf13/viper"
+)
+
+// PromotionTarget registry the images are promoted to from the source registry.
+type PromotionTarget struct {
+	// Name is shown on UI and used to pick the target in API and CLI.
+	Name string `mapstructure:"name"`
+	// Source registry name, images of any other registry can be promoted when empty.
+	Source string `mapstructure:"source"`
+	// Target registry name, it is accessed with its own credentials.
+	Target string `mapstructure:"target"`
+}
+
+// Promotion result of promoting the image.
+type Promotion struct {
+	Digest string `json:"digest"`
+	// Tag on the target registry, empty when pushed by digest only.
+	Tag string `json:"tag"`
+	// Referrers digests of the artifacts copied along with the image.
+	Referrers []string `json:"referrers"`
+}
+
+// ReadPromotionTargets read the list of promotion targets from the config and check their registries are configured.
+func ReadPromotionTargets(registries []RegistryConfig) ([]PromotionTarget, error) {
+	targets := []PromotionTarget{}
+	if err := viper.UnmarshalKey("promotion_targets", &targets); err != nil {
+		return nil, fmt.Errorf("cannot parse promotion targets config: %w", err)
+	}
+
+	registryNames := []string{}
+	for _, r := range registries {
+		registryNames = append(registryNames, r.Name)
+	}
+	names := []string{}
+	for i, t := range targets {
+		if t.Name == "" {
+			return nil, fmt.Errorf("promotion target #%d has no name configured", i+1)
+		}
+		if ItemInSlice(t.Name, names) {
+			return nil, fmt.Errorf("promotion target name %s is not unique", t.Name)
+		}
+		if !ItemInSlice(t.Target, registryNames) {
+			return nil, fmt.Errorf("promotion target %s: unknown target registry %q", t.Name, t.Target)
+		}
+		if t.Source != "" && !ItemInSlice(t.Source, registryNames) {
+			return nil, fmt.Errorf("promotion target %s: unknown source registry %q", t.Name, t.Source)
+		}
+		if t.Source == t.Target {
+			return nil, fmt.Errorf("promotion target %s: source and target registries are the same", t.Name)
+		}
+		names = append(names, t.Name)
+	}
+	return targets, nil
+}
+
+// AllowsSource whether images of the registry can be promoted to the target.
+func (t PromotionTarget) AllowsSource(registry string) bool {
+	return registry != t.Target && (t.Source == "" || t.Source == registry)
+}
+
+// Promote copy the image or the whole index by the reference (repo:tag or repo@digest) to the same repo of the target
+// registry along with all its referrers such as signatures, SBOMs and attestations.
+// The image is tagged with the tag on the target registry, it defaults to the source tag.
+// The image referenced by digest without the tag is pushed by digest only.
+func (c *Client) Promote(ctx context.Context, target *Client, imageRef, tag string) (Promotion, error) {
+	ctx, cancel := withTimeout(ctx, c.timeouts.copyImage)
+	defer cancel()
+	ref, err := name.ParseReference(c.hostname+"/"+imageRef, c.nameOptions...)
+	if err != nil {
+		c.logger.Errorf("Error parsing image reference %s: %s", imageRef, err)
+		return Promotion{}, err
+	}
+	repoPath := ref.Context().RepositoryStr()
+	if t, ok := ref.(name.Tag); ok && tag == "" {
+		tag = t.TagStr()
+	}
+	res := Promotion{Tag: tag, Referrers: []string{}}
+	targetRepo, err := name.NewRepository(target.hostname+"/"+repoPath, target.nameOptions...)
+	if err != nil {
+		return res, err
+	}
+	var targetRef name.Reference
+	if tag != "" {
+		if targetRef, err = name.NewTag(targetRepo.Name()+":"+tag, target.nameOptions...); err != nil {
+			return res, err
+		}
+	}
+
+	descr, err := c.getPuller().Get(ctx, ref)
+	if err != nil {
+		c.logger.Errorf("Error fetching image reference %s: %s", imageRef, err)
+		return res, wrapError(err)
+	}
+	res.Digest = descr.Digest.String()
+	if targetRef == nil {
+		targetRef = targetRepo.Digest(res.Digest)
+	}
+	if err := target.getPusher().Push(ctx, targetRef, descr); err != nil {
+		c.logger.Errorf("Error promoting %s to %s: %s", imageRef, targetRef, err)
+		return res, wrapError(err)
+	}
+
+	referrers, err := c.ListReferrers(ctx, repoPath, res.Digest)
+	if err != nil {
+		return res, fmt.Errorf("image is promoted but its referrers are not: %w", err)
+	}
+	for _, r := range referrers {
+		rd, err := c.getPuller().Get(ctx, ref.Context().Digest(r.Digest))
+		if err != nil {
+			c.logger.Errorf("Error fetching referrer %s@%s: %s", repoPath, r.Digest, err)
+			return res, fmt.Errorf("image is promoted but referrer %s is not: %w", r.Digest, wrapError(err))
+		}
+		// Cosign artifacts are attached by the tag, others by the subject field.
+		var rref name.Reference = targetRepo.Digest(r.Digest)
+		if r.Tag != "" {
+			rref = targetRepo.Tag(r.Tag)
+		}
+		if err := target.getPusher().Push(ctx, rref, rd); err != nil {
+			c.logger.Errorf("Error promoting referrer %s@%s to %s: %s", repoPath, r.Digest, rref, err)
+			return res, fmt.Errorf("image is promoted but referrer %s is not: %w", r.Digest, wrapError(err))
+		}
+		res.Referrers = append(res.Referrers, r.Digest)
+	}
+
+	c.logger.Infof("Image %s has been promoted to %s with %d referrers.", imageRef, targetRef, len(res.Referrers))
+	target.ApplyEvent("push", repoPath, targetRef.Identifier())
+	return res, nil
+}
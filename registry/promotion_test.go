@@ -0,0 +1,36 @@
+package registry
+
+import (
+	"testing"
+
+	"github.com/smartystreets/goconvey/convey"
+	"github.com/spf13/viper"
+)
+
+func TestReadPromotionTargets(t *testing.T) {
+	convey.Convey("Read promotion targets and check their registries", t, func() {
+		registries := []RegistryConfig{{Name: "staging"}, {Name: "dev"}, {Name: "prod"}}
+		defer viper.Set("promotion_targets", nil)
+
+		viper.Set("promotion_targets", []map[string]string{{"name": "to-prod", "source": "staging", "target": "prod"}, {"name": "any", "target": "staging"}})
+		targets, err := ReadPromotionTargets(registries)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(targets, convey.ShouldResemble, []PromotionTarget{{Name: "to-prod", Source: "staging", Target: "prod"}, {Name: "any", Target: "staging"}})
+		convey.So(targets[0].AllowsSource("staging"), convey.ShouldBeTrue)
+		convey.So(targets[0].AllowsSource("dev"), convey.ShouldBeFalse)
+		convey.So(targets[1].AllowsSource("dev"), convey.ShouldBeTrue)
+		convey.So(targets[1].AllowsSource("staging"), convey.ShouldBeFalse)
+
+		viper.Set("promotion_targets", []map[string]string{{"name": "x", "target": "qa"}})
+		_, err = ReadPromotionTargets(registries)
+		convey.So(err, convey.ShouldBeError, `promotion target x: unknown target registry "qa"`)
+
+		viper.Set("promotion_targets", []map[string]string{{"name": "x", "source": "prod", "target": "prod"}})
+		_, err = ReadPromotionTargets(registries)
+		convey.So(err, convey.ShouldBeError, "promotion target x: source and target registries are the same")
+
+		viper.Set("promotion_targets", []map[string]string{{"name": "x", "target": "prod"}, {"name": "x", "target": "dev"}})
+		_, err = ReadPromotionTargets(registries)
+		convey.So(err, convey.ShouldBeError, "promotion target name x is not unique")
+	})
+}
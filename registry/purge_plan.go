@@ -0,0 +1,188 @@
+package registry
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Purge plan actions.
+// Skip is set for the repos and tags which are not evaluated, e.g. excluded by policy or on errors,
+// the tag is empty when the whole repo is skipped.
+const (
+	PlanKeep  = "keep"
+	PlanPurge = "purge"
+	PlanSkip  = "skip"
+)
+
+// planCSVHeader columns of the purge plan in CSV format.
+var planCSVHeader = []string{"registry", "repo", "tag", "digest", "created", "action", "policy", "reason"}
+
+// PurgePlanEntry decision of the purging task about the tag.
+// Created time is omitted when unknown or zero.
+type PurgePlanEntry struct {
+	Registry string    `json:"registry"`
+	Repo     string    `json:"repo"`
+	Tag      string    `json:"tag"`
+	Digest   string    `json:"digest"`
+	Created  time.Time `json:"created,omitzero"`
+	Action   string    `json:"action"`
+	Policy   string    `json:"policy"`
+	Reason   string    `json:"reason"`
+}
+
+// isCSV whether the plan file is CSV by its extension, otherwise it is JSON.
+func isCSV(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".csv")
+}
+
+// WritePurgePlan write the purge plan to the file as JSON or CSV depending on its extension.
+func WritePurgePlan(path string, plan []PurgePlanEntry) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if !isCSV(path) {
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		return enc.Encode(plan)
+	}
+	w := csv.NewWriter(f)
+	w.Write(planCSVHeader)
+	for _, e := range plan {
+		created := ""
+		if !e.Created.IsZero() {
+			created = e.Created.Format(time.RFC3339)
+		}
+		w.Write([]string{e.Registry, e.Repo, e.Tag, e.Digest, created, e.Action, e.Policy, e.Reason})
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// ReadPurgePlan read the purge plan written by WritePurgePlan.
+func ReadPurgePlan(path string) ([]PurgePlanEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	plan := []PurgePlanEntry{}
+	if !isCSV(path) {
+		if err := json.NewDecoder(f).Decode(&plan); err != nil {
+			return nil, fmt.Errorf("cannot parse purge plan %s: %w", path, err)
+		}
+		return plan, nil
+	}
+
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse purge plan %s: %w", path, err)
+	}
+	if len(records) == 0 || strings.Join(records[0], ",") != strings.Join(planCSVHeader, ",") {
+		return nil, fmt.Errorf("cannot parse purge plan %s: unexpected CSV header", path)
+	}
+	for i, r := range records[1:] {
+		var created time.Time
+		if r[4] != "" {
+			if created, err = time.Parse(time.RFC3339, r[4]); err != nil {
+				return nil, fmt.Errorf("cannot parse purge plan %s line %d: %w", path, i+2, err)
+			}
+		}
+		plan = append(plan, PurgePlanEntry{Registry: r[0], Repo: r[1], Tag: r[2], Digest: r[3], Created: created,
+			Action: r[5], Policy: r[6], Reason: r[7]})
+	}
+	return plan, nil
+}
+
+// ApplyPurgePlan delete the tags the plan lists to purge, nothing else.
+// Each tag is deleted only if it still points to the digest of the plan, otherwise it is skipped with an error.
+// The tags sharing the digest with other tags are untagged, so the tags not listed are never deleted along.
+// The tags of each repo are checked for the shared digests once before purging its first tag.
+func ApplyPurgePlan(ctx context.Context, client *Client, path string, purgeDryRun bool) error {
+	logger := SetupLogging("registry.tasks.ApplyPurgePlan")
+	plan, err := ReadPurgePlan(path)
+	if err != nil {
+		logger.Error("Not purging anything!")
+		return err
+	}
+	dryRunText := ""
+	if purgeDryRun {
+		logger.Warn("Dry-run mode enabled.")
+		dryRunText = " skipped"
+	}
+
+	count, errCount := 0, 0
+	// The number of tags pointing to the digest per repo.
+	digestTags := map[string]map[string]int{}
+	for _, e := range plan {
+		if e.Action != PlanPurge {
+			continue
+		}
+		if e.Registry != client.Name() {
+			logger.Errorf("[%s] tag %s is planned for registry %s, skipping it", e.Repo, e.Tag, e.Registry)
+			errCount++
+			continue
+		}
+		details, err := client.GetTagDetails(ctx, e.Repo, e.Tag)
+		if errors.Is(err, ErrNotFound) {
+			logger.Warnf("[%s] tag %s is already gone", e.Repo, e.Tag)
+			continue
+		}
+		if err != nil {
+			logger.Errorf("[%s] cannot verify digest of tag %s, skipping it: %s", e.Repo, e.Tag, err)
+			errCount++
+			continue
+		}
+		if details.Digest != e.Digest {
+			logger.Errorf("[%s] tag %s points to %s instead of %s from the plan, skipping it", e.Repo, e.Tag, details.Digest, e.Digest)
+			errCount++
+			continue
+		}
+
+		logger.Infof("[%s] Purging tag %s (%s)...%s", e.Repo, e.Tag, e.Reason, dryRunText)
+		if purgeDryRun {
+			continue
+		}
+		if digestTags[e.Repo] == nil {
+			tags, err := client.getDigestTags(ctx, e.Repo)
+			if err != nil {
+				logger.Errorf("[%s] cannot check tags sharing digests, skipping tag %s: %s", e.Repo, e.Tag, err)
+				errCount++
+				continue
+			}
+			digestTags[e.Repo] = map[string]int{}
+			for digest, t := range tags {
+				digestTags[e.Repo][digest] = len(t)
+			}
+		}
+		if digestTags[e.Repo][e.Digest] == 1 {
+			err = client.DeleteTag(ctx, e.Repo, e.Tag)
+		} else {
+			// Also when the tag was pushed after checking, as it is unknown whether it shares the digest.
+			_, err = client.UntagSharedTag(ctx, e.Repo, e.Tag)
+		}
+		if err != nil {
+			logger.Errorf("[%s] cannot purge tag %s: %s", e.Repo, e.Tag, err)
+			errCount++
+			continue
+		}
+		digestTags[e.Repo][e.Digest]--
+		count++
+	}
+	logger.Infof("Purged %d tags.", count)
+	if errCount > 0 {
+		return fmt.Errorf("applying purge plan finished with %d errors, see the log above", errCount)
+	}
+	logger.Info("Done.")
+	return nil
+}
@@ -0,0 +1,70 @@
+package registry
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestPurgePlan(t *testing.T) {
+	convey.Convey("Write and read the purge plan as JSON and CSV", t, func() {
+		created := time.Date(2025, 6, 1, 12, 30, 0, 0, time.UTC)
+		plan := []PurgePlanEntry{
+			{Registry: "default", Repo: "a/b", Tag: "1", Digest: "sha256:1", Created: created, Action: PlanKeep,
+				Policy: "team-a", Reason: "in use by pods.json Pod/prod/app, \"quoted\""},
+			{Registry: "default", Repo: "a/b", Tag: "0", Digest: "sha256:0", Created: created.AddDate(0, -3, 0),
+				Action: PlanPurge, Policy: "team-a", Reason: "older than 30 days"},
+			{Registry: "default", Repo: "a/c", Tag: "sig", Digest: "sha256:2", Action: PlanKeep, Policy: "default",
+				Reason: "zero creation time"},
+			{Registry: "default", Repo: "a/d", Action: PlanSkip, Policy: "frozen", Reason: "excluded by purge policy frozen"},
+		}
+		dir := t.TempDir()
+		for _, file := range []string{"plan.json", "plan.CSV"} {
+			path := filepath.Join(dir, file)
+			convey.So(WritePurgePlan(path, plan), convey.ShouldBeNil)
+			res, err := ReadPurgePlan(path)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(res, convey.ShouldResemble, plan)
+		}
+		data, _ := os.ReadFile(filepath.Join(dir, "plan.CSV"))
+		convey.So(string(data), convey.ShouldContainSubstring, "\ndefault,a/d,,,,skip,frozen,excluded by purge policy frozen\n")
+		data, _ = os.ReadFile(filepath.Join(dir, "plan.json"))
+		convey.So(string(data), convey.ShouldNotContainSubstring, "0001-01-01")
+
+		path := filepath.Join(dir, "other.csv")
+		os.WriteFile(path, []byte("repo,tag\na/b,1\n"), 0o644)
+		_, err := ReadPurgePlan(path)
+		convey.So(err, convey.ShouldNotBeNil)
+	})
+}
+
+func TestApplyPurgePlan(t *testing.T) {
+	convey.Convey("Purge the planned tags only, keeping the tags sharing their digests", t, func() {
+		c := newTestClient(t, []string{"1", "2"}, []string{"3"}, []string{"4", "5"})
+		details, errs := c.GetTagsDetails(context.Background(), "app", []string{"1", "3", "4", "5"})
+		convey.So(errs, convey.ShouldResemble, []error{nil, nil, nil, nil})
+		plan := []PurgePlanEntry{}
+		for _, d := range details {
+			plan = append(plan, PurgePlanEntry{Registry: "test", Repo: "app", Tag: d.Tag, Digest: d.Digest, Action: PlanPurge})
+		}
+		path := filepath.Join(t.TempDir(), "plan.json")
+		convey.So(WritePurgePlan(path, plan), convey.ShouldBeNil)
+
+		convey.So(ApplyPurgePlan(context.Background(), c, path, false), convey.ShouldBeNil)
+		// Tags 1 and 4 are untagged, then 5 is the last tag of its image which is deleted by digest like 3.
+		tags, err := c.ListTags(context.Background(), "app")
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(tags, convey.ShouldNotContain, "1")
+		convey.So(tags, convey.ShouldNotContain, "4")
+		_, err = c.GetImageInfo(context.Background(), "app@"+details[0].Digest)
+		convey.So(err, convey.ShouldBeNil)
+		for _, d := range details[1:] {
+			_, err = c.GetImageInfo(context.Background(), "app@"+d.Digest)
+			convey.So(err, convey.ShouldWrap, ErrNotFound)
+		}
+	})
+}
@@ -0,0 +1,270 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/viper"
+)
+
+// Purge policy match modes.
+const (
+	PolicyMatchFirst        = "first"
+	PolicyMatchMostSpecific = "most_specific"
+)
+
+// defaultPolicyName name of the effective policy built from the global purge_tags options.
+const defaultPolicyName = "default"
+
+// PurgePolicy keep rules applied to the repos matching its globs or regexp instead of the global ones.
+// The rules which are not set are inherited from the global purge_tags options.
+type PurgePolicy struct {
+	Name string `mapstructure:"name"`
+	// Repos globs, "*" matches within a path segment, "**" across segments.
+	Repos       []string `mapstructure:"repos"`
+	ReposRegexp string   `mapstructure:"repos_regexp"`
+	KeepDays    *int     `mapstructure:"keep_days"`
+	KeepCount   *int     `mapstructure:"keep_count"`
+	KeepRegexps []string `mapstructure:"keep_regexps"`
+	// KeepSemverPatches the number of the highest patch releases to keep per major.minor of semver tags.
+	KeepSemverPatches *int `mapstructure:"keep_semver_patches"`
+	// KeepSemverLatest never purge the highest semver release tag.
+	KeepSemverLatest *bool `mapstructure:"keep_semver_latest"`
+	// KeepIfPulledWithinDays keep tags pulled recently according to the event log, 0 disables it.
+	KeepIfPulledWithinDays *int `mapstructure:"keep_if_pulled_within_days"`
+	// Exclude the matching repos from purging.
+	Exclude bool `mapstructure:"exclude"`
+
+	patterns []repoPattern
+}
+
+// repoPattern compiled repo glob or regexp with its specificity.
+type repoPattern struct {
+	re *regexp.Regexp
+	// specificity the number of literal characters, math.MaxInt for an exact repo name.
+	specificity int
+}
+
+// PurgeRules effective keep rules of the repo.
+type PurgeRules struct {
+	Policy                 string
+	KeepDays               int
+	KeepCount              int
+	KeepRegexps            []*regexp.Regexp
+	KeepSemverPatches      int
+	KeepSemverLatest       bool
+	KeepIfPulledWithinDays int
+	Exclude                bool
+}
+
+// PurgePolicies per-repo policies on top of the global purge_tags options.
+type PurgePolicies struct {
+	defaults PurgeRules
+	policies []PurgePolicy
+	match    string
+}
+
+// ReadPurgePolicies read the global purge_tags options and the list of per-repo policies.
+func ReadPurgePolicies() (*PurgePolicies, error) {
+	p := &PurgePolicies{
+		defaults: PurgeRules{
+			Policy:                 defaultPolicyName,
+			KeepDays:               viper.GetInt("purge_tags.keep_days"),
+			KeepCount:              viper.GetInt("purge_tags.keep_count"),
+			KeepSemverPatches:      viper.GetInt("purge_tags.keep_semver_patches"),
+			KeepSemverLatest:       viper.GetBool("purge_tags.keep_semver_latest"),
+			KeepIfPulledWithinDays: viper.GetInt("purge_tags.keep_if_pulled_within_days"),
+		},
+		match: viper.GetString("purge_tags.policy_match"),
+	}
+	if keepRegexp := viper.GetString("purge_tags.keep_regexp"); keepRegexp != "" {
+		re, err := regexp.Compile(keepRegexp)
+		if err != nil {
+			return nil, fmt.Errorf("invalid purge_tags.keep_regexp: %w", err)
+		}
+		p.defaults.KeepRegexps = []*regexp.Regexp{re}
+	}
+	if p.match == "" {
+		p.match = PolicyMatchFirst
+	}
+	if p.match != PolicyMatchFirst && p.match != PolicyMatchMostSpecific {
+		return nil, fmt.Errorf("invalid purge_tags.policy_match %q, should be %s or %s", p.match, PolicyMatchFirst, PolicyMatchMostSpecific)
+	}
+
+	if err := viper.UnmarshalKey("purge_tags.policies", &p.policies); err != nil {
+		return nil, fmt.Errorf("cannot parse purge policies config: %w", err)
+	}
+	for i := range p.policies {
+		policy := &p.policies[i]
+		if policy.Name == "" {
+			policy.Name = fmt.Sprintf("#%d", i+1)
+		}
+		if len(policy.Repos) == 0 && policy.ReposRegexp == "" {
+			return nil, fmt.Errorf("purge policy %s has neither repos nor repos_regexp configured", policy.Name)
+		}
+		for _, glob := range policy.Repos {
+			policy.patterns = append(policy.patterns, globPattern(glob))
+		}
+		if policy.ReposRegexp != "" {
+			re, err := regexp.Compile(policy.ReposRegexp)
+			if err != nil {
+				return nil, fmt.Errorf("purge policy %s: invalid repos_regexp: %w", policy.Name, err)
+			}
+			prefix, complete := re.LiteralPrefix()
+			specificity := len(prefix)
+			if complete {
+				specificity = math.MaxInt
+			}
+			policy.patterns = append(policy.patterns, repoPattern{re: re, specificity: specificity})
+		}
+		for _, keepRegexp := range policy.KeepRegexps {
+			if _, err := regexp.Compile(keepRegexp); err != nil {
+				return nil, fmt.Errorf("purge policy %s: invalid keep_regexps: %w", policy.Name, err)
+			}
+		}
+	}
+	return p, nil
+}
+
+// globPattern convert the repo glob to the anchored regexp.
+func globPattern(glob string) repoPattern {
+	var b strings.Builder
+	literals := 0
+	b.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch {
+		case strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case glob[i] == '*':
+			b.WriteString("[^/]*")
+		case glob[i] == '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+			literals++
+		}
+	}
+	b.WriteString("$")
+	if literals == len(glob) {
+		literals = math.MaxInt
+	}
+	return repoPattern{re: regexp.MustCompile(b.String()), specificity: literals}
+}
+
+// For effective keep rules of the repo.
+// With "first" match mode the first matching policy is used, with "most_specific" one the policy with the most
+// specific matching pattern: exact repo name, then the longest literal part of the glob or regexp prefix.
+// The global rules are used when no policy matches.
+func (p *PurgePolicies) For(repo string) PurgeRules {
+	var (
+		matched *PurgePolicy
+		best    = -1
+	)
+	for i := range p.policies {
+		policy := &p.policies[i]
+		for _, pattern := range policy.patterns {
+			if pattern.re.MatchString(repo) && pattern.specificity > best {
+				matched, best = policy, pattern.specificity
+			}
+		}
+		if matched != nil && p.match == PolicyMatchFirst {
+			break
+		}
+	}
+	if matched == nil {
+		return p.defaults
+	}
+
+	rules := p.defaults
+	rules.Policy = matched.Name
+	rules.Exclude = matched.Exclude
+	if matched.KeepDays != nil {
+		rules.KeepDays = *matched.KeepDays
+	}
+	if matched.KeepCount != nil {
+		rules.KeepCount = *matched.KeepCount
+	}
+	if matched.KeepSemverPatches != nil {
+		rules.KeepSemverPatches = *matched.KeepSemverPatches
+	}
+	if matched.KeepSemverLatest != nil {
+		rules.KeepSemverLatest = *matched.KeepSemverLatest
+	}
+	if matched.KeepIfPulledWithinDays != nil {
+		rules.KeepIfPulledWithinDays = *matched.KeepIfPulledWithinDays
+	}
+	if matched.KeepRegexps != nil {
+		rules.KeepRegexps = []*regexp.Regexp{}
+		for _, keepRegexp := range matched.KeepRegexps {
+			rules.KeepRegexps = append(rules.KeepRegexps, regexp.MustCompile(keepRegexp))
+		}
+	}
+	return rules
+}
+
+// String short description of the rules for logging.
+func (r PurgeRules) String() string {
+	if r.Exclude {
+		return fmt.Sprintf("policy %s: excluded", r.Policy)
+	}
+	s := fmt.Sprintf("policy %s: keep %d days, keep count %d, keep regexps %v", r.Policy, r.KeepDays, r.KeepCount, r.KeepRegexps)
+	if semver := r.semverString(); semver != "" {
+		s += ", keep semver " + semver
+	}
+	if r.KeepIfPulledWithinDays > 0 {
+		s += fmt.Sprintf(", keep pulled within %d days", r.KeepIfPulledWithinDays)
+	}
+	return s
+}
+
+// semverString short description of the semver rules, empty when not set.
+func (r PurgeRules) semverString() string {
+	rules := []string{}
+	if r.KeepSemverPatches > 0 {
+		rules = append(rules, fmt.Sprintf("%d patches per minor", r.KeepSemverPatches))
+	}
+	if r.KeepSemverLatest {
+		rules = append(rules, "highest")
+	}
+	return strings.Join(rules, " and ")
+}
+
+// PrintPurgePolicies print the effective purge policy of each repo of the catalog.
+func PrintPurgePolicies(ctx context.Context, client *Client, w io.Writer, purgeIncludeRepos, purgeExcludeRepos string) error {
+	logger := SetupLogging("registry.tasks.PrintPurgePolicies")
+	policies, err := ReadPurgePolicies()
+	if err != nil {
+		return err
+	}
+	catalog, err := purgeCatalog(ctx, client, logger, purgeIncludeRepos, purgeExcludeRepos)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "REPO\tPOLICY\tKEEP DAYS\tKEEP COUNT\tKEEP REGEXPS\tKEEP SEMVER\tKEEP PULLED DAYS")
+	for _, repo := range catalog {
+		rules := policies.For(repo)
+		if rules.Exclude {
+			fmt.Fprintf(tw, "%s\t%s\texcluded\t\t\t\t\n", repo, rules.Policy)
+			continue
+		}
+		regexps := []string{}
+		for _, re := range rules.KeepRegexps {
+			regexps = append(regexps, re.String())
+		}
+		pulled := ""
+		if rules.KeepIfPulledWithinDays > 0 {
+			pulled = fmt.Sprint(rules.KeepIfPulledWithinDays)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%s\t%s\t%s\n", repo, rules.Policy, rules.KeepDays, rules.KeepCount,
+			strings.Join(regexps, " "), rules.semverString(), pulled)
+	}
+	return tw.Flush()
+}
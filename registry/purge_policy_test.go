@@ -0,0 +1,65 @@
+package registry
+
+import (
+	"testing"
+
+	"github.com/smartystreets/goconvey/convey"
+	"github.com/spf13/viper"
+)
+
+func TestPurgePolicies(t *testing.T) {
+	convey.Convey("Pick the purge policy of the repo", t, func() {
+		viper.Set("purge_tags.keep_days", 90)
+		viper.Set("purge_tags.keep_count", 10)
+		viper.Set("purge_tags.keep_regexp", "^latest$")
+		defer func() {
+			for _, key := range []string{"keep_days", "keep_count", "keep_regexp", "policies", "policy_match"} {
+				viper.Set("purge_tags."+key, nil)
+			}
+		}()
+		viper.Set("purge_tags.policies", []map[string]interface{}{
+			{"name": "team-a", "repos": []string{"team-a/**"}, "keep_days": 30, "keep_if_pulled_within_days": 14},
+			{"name": "team-a-app", "repos": []string{"team-a/app"}, "keep_count": 3, "keep_regexps": []string{"^v", "^release-"}},
+			{"name": "mirrors", "repos_regexp": "^(dockerhub|quay)/", "exclude": true},
+			{"name": "single-level", "repos": []string{"tools/*"}, "keep_days": 7, "keep_semver_patches": 2, "keep_semver_latest": true},
+		})
+
+		policies, err := ReadPurgePolicies()
+		convey.So(err, convey.ShouldBeNil)
+		rules := policies.For("team-a/app")
+		convey.So(rules.String(), convey.ShouldEqual, "policy team-a: keep 30 days, keep count 10, keep regexps [^latest$], keep pulled within 14 days")
+		convey.So(policies.For("team-a/x/y").Policy, convey.ShouldEqual, "team-a")
+		convey.So(policies.For("quay/coreos/etcd").Exclude, convey.ShouldBeTrue)
+		convey.So(policies.For("tools/jq").String(), convey.ShouldEqual,
+			"policy single-level: keep 7 days, keep count 10, keep regexps [^latest$], keep semver 2 patches per minor and highest")
+		convey.So(policies.For("tools/x/jq").Policy, convey.ShouldEqual, "default")
+		convey.So(policies.For("team-b/app").String(), convey.ShouldEqual, "policy default: keep 90 days, keep count 10, keep regexps [^latest$]")
+
+		viper.Set("purge_tags.policy_match", PolicyMatchMostSpecific)
+		policies, err = ReadPurgePolicies()
+		convey.So(err, convey.ShouldBeNil)
+		rules = policies.For("team-a/app")
+		convey.So(rules.String(), convey.ShouldEqual, "policy team-a-app: keep 90 days, keep count 3, keep regexps [^v ^release-]")
+		convey.So(policies.For("team-a/web").Policy, convey.ShouldEqual, "team-a")
+	})
+
+	convey.Convey("Reject invalid purge policies", t, func() {
+		defer func() {
+			viper.Set("purge_tags.policies", nil)
+			viper.Set("purge_tags.policy_match", nil)
+		}()
+		viper.Set("purge_tags.policies", []map[string]interface{}{{"name": "x", "keep_days": 1}})
+		_, err := ReadPurgePolicies()
+		convey.So(err, convey.ShouldBeError, "purge policy x has neither repos nor repos_regexp configured")
+
+		viper.Set("purge_tags.policies", []map[string]interface{}{{"repos": []string{"a"}, "keep_regexps": []string{"("}}})
+		_, err = ReadPurgePolicies()
+		convey.So(err, convey.ShouldNotBeNil)
+		convey.So(err.Error(), convey.ShouldStartWith, "purge policy #1: invalid keep_regexps")
+
+		viper.Set("purge_tags.policies", nil)
+		viper.Set("purge_tags.policy_match", "last")
+		_, err = ReadPurgePolicies()
+		convey.So(err, convey.ShouldNotBeNil)
+	})
+}
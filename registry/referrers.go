@@ -0,0 +1,147 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// Kind of the artifact attached to the image.
+const (
+	ArtifactSignature   = "signature"
+	ArtifactSBOM        = "sbom"
+	ArtifactAttestation = "attestation"
+	ArtifactOther       = "other"
+)
+
+// cosignSuffixes artifact kinds of the cosign tags "sha256-<hex>.<suffix>".
+var cosignSuffixes = map[string]string{
+	"sig":  ArtifactSignature,
+	"att":  ArtifactAttestation,
+	"sbom": ArtifactSBOM,
+}
+
+// artifactTagRegexp cosign tags and the referrers tag schema fallback tags "sha256-<hex>".
+var artifactTagRegexp = regexp.MustCompile(`^sha256-([a-f0-9]{64})(?:\.(sig|att|sbom))?$`)
+
+// Referrer artifact attached to the image such as signature, SBOM or provenance attestation.
+type Referrer struct {
+	Digest       string            `json:"digest"`
+	ArtifactType string            `json:"artifactType"`
+	Kind         string            `json:"kind"`
+	MediaType    string            `json:"mediaType"`
+	Size         int64             `json:"size"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+	// Tag of cosign artifacts which are attached by the tag naming convention instead of the subject field.
+	Tag string `json:"tag,omitempty"`
+}
+
+// ReferrerGroup referrers of the same kind.
+type ReferrerGroup struct {
+	Kind      string     `json:"kind"`
+	Referrers []Referrer `json:"referrers"`
+}
+
+// IsArtifactTag whether the tag is a cosign artifact or referrers fallback tag rather than an image tag.
+func IsArtifactTag(tag string) bool {
+	return artifactTagRegexp.MatchString(tag)
+}
+
+// ArtifactTagSubject digest of the image the artifact tag is attached to.
+func ArtifactTagSubject(tag string) (string, bool) {
+	m := artifactTagRegexp.FindStringSubmatch(tag)
+	if m == nil {
+		return "", false
+	}
+	return "sha256:" + m[1], true
+}
+
+// ArtifactKind classify the artifact by its type, e.g. "application/spdx+json" is an SBOM.
+func ArtifactKind(artifactType string) string {
+	t := strings.ToLower(artifactType)
+	switch {
+	case strings.Contains(t, "signature") || strings.Contains(t, "cosign.simplesigning") || strings.Contains(t, "sigstore.bundle") || strings.Contains(t, "notary"):
+		return ArtifactSignature
+	case strings.Contains(t, "spdx") || strings.Contains(t, "cyclonedx") || strings.Contains(t, "syft") || strings.Contains(t, "sbom"):
+		return ArtifactSBOM
+	case strings.Contains(t, "in-toto") || strings.Contains(t, "dsse") || strings.Contains(t, "provenance") || strings.Contains(t, "slsa") || strings.Contains(t, "attestation"):
+		return ArtifactAttestation
+	}
+	return ArtifactOther
+}
+
+// ListReferrers list artifacts attached to the image digest. The referrers API is queried with the fallback to
+// the referrers tag schema, then the cosign tags "sha256-<hex>.sig", ".att" and ".sbom" are checked.
+func (c *Client) ListReferrers(ctx context.Context, repoName, digest string) ([]Referrer, error) {
+	ctx, cancel := withTimeout(ctx, c.timeouts.imageInfo)
+	defer cancel()
+	ref, err := name.NewDigest(c.hostname+"/"+repoName+"@"+digest, c.nameOptions...)
+	if err != nil {
+		return nil, err
+	}
+
+	res := []Referrer{}
+	idx, err := remote.Referrers(ref, remote.WithContext(ctx), remote.Reuse(c.getPuller()))
+	if err != nil {
+		c.logger.Errorf("Error fetching referrers of %s: %s", ref, err)
+		return nil, wrapError(err)
+	}
+	idxMf, err := idx.IndexManifest()
+	if err != nil {
+		c.logger.Errorf("Error reading referrers of %s: %s", ref, err)
+		return nil, wrapError(err)
+	}
+	for _, m := range idxMf.Manifests {
+		res = append(res, Referrer{
+			Digest:       m.Digest.String(),
+			ArtifactType: m.ArtifactType,
+			Kind:         ArtifactKind(m.ArtifactType),
+			MediaType:    string(m.MediaType),
+			Size:         m.Size,
+			Annotations:  m.Annotations,
+		})
+	}
+
+	prefix := strings.Replace(digest, ":", "-", 1)
+	for _, suffix := range SortedMapKeys(cosignSuffixes) {
+		tag := prefix + "." + suffix
+		head, err := c.getPuller().Head(ctx, ref.Context().Tag(tag))
+		if err != nil {
+			if err = wrapError(err); errors.Is(err, ErrNotFound) {
+				continue
+			}
+			c.logger.Errorf("Error fetching cosign tag %s:%s: %s", repoName, tag, err)
+			return nil, err
+		}
+		res = append(res, Referrer{
+			Digest:       head.Digest.String(),
+			ArtifactType: head.ArtifactType,
+			Kind:         cosignSuffixes[suffix],
+			MediaType:    string(head.MediaType),
+			Size:         head.Size,
+			Tag:          tag,
+		})
+	}
+	return res, nil
+}
+
+// GroupReferrers group the referrers by kind in the order of signatures, SBOMs, attestations and others.
+func GroupReferrers(referrers []Referrer) []ReferrerGroup {
+	groups := []ReferrerGroup{}
+	for _, kind := range []string{ArtifactSignature, ArtifactSBOM, ArtifactAttestation, ArtifactOther} {
+		g := ReferrerGroup{Kind: kind}
+		for _, r := range referrers {
+			if r.Kind == kind {
+				g.Referrers = append(g.Referrers, r)
+			}
+		}
+		if len(g.Referrers) > 0 {
+			groups = append(groups, g)
+		}
+	}
+	return groups
+}
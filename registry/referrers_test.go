@@ -0,0 +1,43 @@
+package registry
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestArtifactTags(t *testing.T) {
+	hex := strings.Repeat("ab", 32)
+	convey.Convey("Detect cosign and referrers fallback tags", t, func() {
+		convey.So(IsArtifactTag("sha256-"+hex), convey.ShouldBeTrue)
+		convey.So(IsArtifactTag("sha256-"+hex+".sig"), convey.ShouldBeTrue)
+		convey.So(IsArtifactTag("sha256-"+hex+".att"), convey.ShouldBeTrue)
+		convey.So(IsArtifactTag("sha256-"+hex+".sbom"), convey.ShouldBeTrue)
+		convey.So(IsArtifactTag("sha256-"+hex+".foo"), convey.ShouldBeFalse)
+		convey.So(IsArtifactTag("sha256-abc.sig"), convey.ShouldBeFalse)
+		convey.So(IsArtifactTag("latest"), convey.ShouldBeFalse)
+
+		subject, ok := ArtifactTagSubject("sha256-" + hex + ".sig")
+		convey.So(ok, convey.ShouldBeTrue)
+		convey.So(subject, convey.ShouldEqual, "sha256:"+hex)
+		_, ok = ArtifactTagSubject("v1.0")
+		convey.So(ok, convey.ShouldBeFalse)
+	})
+
+	convey.Convey("Classify artifacts by type", t, func() {
+		convey.So(ArtifactKind("application/vnd.dev.cosign.simplesigning.v1+json"), convey.ShouldEqual, ArtifactSignature)
+		convey.So(ArtifactKind("application/vnd.cncf.notary.signature"), convey.ShouldEqual, ArtifactSignature)
+		convey.So(ArtifactKind("application/spdx+json"), convey.ShouldEqual, ArtifactSBOM)
+		convey.So(ArtifactKind("application/vnd.cyclonedx+json"), convey.ShouldEqual, ArtifactSBOM)
+		convey.So(ArtifactKind("application/vnd.in-toto+json"), convey.ShouldEqual, ArtifactAttestation)
+		convey.So(ArtifactKind("application/vnd.dev.sigstore.bundle.v0.3+json"), convey.ShouldEqual, ArtifactSignature)
+		convey.So(ArtifactKind("application/vnd.example.readme"), convey.ShouldEqual, ArtifactOther)
+		convey.So(ArtifactKind(""), convey.ShouldEqual, ArtifactOther)
+
+		groups := GroupReferrers([]Referrer{{Digest: "a", Kind: ArtifactOther}, {Digest: "b", Kind: ArtifactSignature}, {Digest: "c", Kind: ArtifactOther}})
+		convey.So(groups, convey.ShouldHaveLength, 2)
+		convey.So(groups[0].Kind, convey.ShouldEqual, ArtifactSignature)
+		convey.So(groups[1].Referrers, convey.ShouldHaveLength, 2)
+	})
+}
@@ -0,0 +1,285 @@
+package registry
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+// maxSBOMSize max size of the SBOM blob to read.
+const maxSBOMSize = 64 << 20
+
+// ErrNotSBOM the artifact does not contain SPDX or CycloneDX document.
+var ErrNotSBOM = fmt.Errorf("%w: no SPDX or CycloneDX document", ErrNotFound)
+
+// ErrSBOMTooLarge the SBOM blob exceeds maxSBOMSize.
+var ErrSBOMTooLarge = errors.New("SBOM too large")
+
+// SBOMPackage package listed in the SBOM.
+type SBOMPackage struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	License string `json:"license"`
+	PURL    string `json:"purl"`
+}
+
+// SBOM software bill of materials of the image.
+type SBOM struct {
+	// Format with the spec version, e.g. "SPDX-2.3" or "CycloneDX 1.5".
+	Format   string        `json:"format"`
+	Name     string        `json:"name,omitempty"`
+	Packages []SBOMPackage `json:"packages"`
+}
+
+type spdxDocument struct {
+	SPDXVersion string `json:"spdxVersion"`
+	Name        string `json:"name"`
+	Packages    []struct {
+		Name             string `json:"name"`
+		VersionInfo      string `json:"versionInfo"`
+		LicenseConcluded string `json:"licenseConcluded"`
+		LicenseDeclared  string `json:"licenseDeclared"`
+		ExternalRefs     []struct {
+			ReferenceType    string `json:"referenceType"`
+			ReferenceLocator string `json:"referenceLocator"`
+		} `json:"externalRefs"`
+	} `json:"packages"`
+}
+
+type cycloneDXComponent struct {
+	Name     string `json:"name"`
+	Group    string `json:"group"`
+	Version  string `json:"version"`
+	PURL     string `json:"purl"`
+	Licenses []struct {
+		License struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		} `json:"license"`
+		Expression string `json:"expression"`
+	} `json:"licenses"`
+	Components []cycloneDXComponent `json:"components"`
+}
+
+type cycloneDXDocument struct {
+	BOMFormat   string `json:"bomFormat"`
+	SpecVersion string `json:"specVersion"`
+	Metadata    struct {
+		Component struct {
+			Name string `json:"name"`
+		} `json:"component"`
+	} `json:"metadata"`
+	Components []cycloneDXComponent `json:"components"`
+}
+
+// dsseEnvelope signed envelope of in-toto attestations.
+type dsseEnvelope struct {
+	PayloadType string `json:"payloadType"`
+	Payload     string `json:"payload"`
+}
+
+// inTotoStatement attestation with the SBOM as predicate.
+type inTotoStatement struct {
+	PredicateType string          `json:"predicateType"`
+	Predicate     json.RawMessage `json:"predicate"`
+}
+
+// SBOMReferrers referrers which may contain SBOM, SBOM artifacts go before attestations.
+func SBOMReferrers(referrers []Referrer) []Referrer {
+	res := []Referrer{}
+	for _, kind := range []string{ArtifactSBOM, ArtifactAttestation} {
+		for _, r := range referrers {
+			if r.Kind == kind {
+				res = append(res, r)
+			}
+		}
+	}
+	return res
+}
+
+// FindSBOM get the SBOM attached to the image digest and the digest of its artifact.
+// The artifact is looked up among the referrers unless it is set.
+func (c *Client) FindSBOM(ctx context.Context, repoName, digest, artifact string) (string, SBOM, error) {
+	if artifact != "" {
+		sbom, err := c.GetSBOM(ctx, repoName, artifact)
+		return artifact, sbom, err
+	}
+	referrers, err := c.ListReferrers(ctx, repoName, digest)
+	if err != nil {
+		return "", SBOM{}, err
+	}
+	for _, r := range SBOMReferrers(referrers) {
+		sbom, err := c.GetSBOM(ctx, repoName, r.Digest)
+		if errors.Is(err, ErrNotSBOM) {
+			// E.g. provenance attestation.
+			continue
+		}
+		return r.Digest, sbom, err
+	}
+	return "", SBOM{}, ErrNotSBOM
+}
+
+// GetSBOM fetch the artifact attached to the image and parse the SBOM of its first layer which contains one.
+func (c *Client) GetSBOM(ctx context.Context, repoName, artifactDigest string) (SBOM, error) {
+	ctx, cancel := withTimeout(ctx, c.timeouts.layerFiles)
+	defer cancel()
+	ref, err := name.NewDigest(c.hostname+"/"+repoName+"@"+artifactDigest, c.nameOptions...)
+	if err != nil {
+		return SBOM{}, err
+	}
+	descr, err := c.getPuller().Get(ctx, ref)
+	if err != nil {
+		c.logger.Errorf("Error fetching artifact %s: %s", ref, err)
+		return SBOM{}, wrapError(err)
+	}
+	img, err := descr.Image()
+	if err != nil {
+		return SBOM{}, fmt.Errorf("artifact %s is not an image manifest: %w", artifactDigest, err)
+	}
+	layers, err := img.Layers()
+	if err != nil {
+		return SBOM{}, wrapError(err)
+	}
+	for _, l := range layers {
+		rc, err := l.Compressed()
+		if err != nil {
+			c.logger.Errorf("Error fetching blob of artifact %s: %s", ref, err)
+			return SBOM{}, wrapError(err)
+		}
+		// One byte more than the limit is read to tell the oversized blob from the one of the max size.
+		data, err := io.ReadAll(io.LimitReader(rc, maxSBOMSize+1))
+		rc.Close()
+		if err != nil {
+			c.logger.Errorf("Error reading blob of artifact %s: %s", ref, err)
+			return SBOM{}, wrapError(err)
+		}
+		if len(data) > maxSBOMSize {
+			return SBOM{}, fmt.Errorf("%w: blob of artifact %s exceeds %s", ErrSBOMTooLarge, artifactDigest, PrettySize(maxSBOMSize))
+		}
+		if sbom, err := ParseSBOM(data); err == nil {
+			return sbom, nil
+		}
+	}
+	return SBOM{}, ErrNotSBOM
+}
+
+// ParseSBOM parse SPDX or CycloneDX JSON document, also wrapped into in-toto statement and DSSE envelope.
+func ParseSBOM(data []byte) (SBOM, error) {
+	var probe map[string]json.RawMessage
+	if err := json.Unmarshal(data, &probe); err != nil {
+		// Predicate may be a JSON encoded string.
+		var s string
+		if json.Unmarshal(data, &s) == nil && s != "" {
+			return ParseSBOM([]byte(s))
+		}
+		return SBOM{}, ErrNotSBOM
+	}
+
+	switch {
+	case probe["payloadType"] != nil && probe["payload"] != nil:
+		var env dsseEnvelope
+		if err := json.Unmarshal(data, &env); err != nil {
+			return SBOM{}, ErrNotSBOM
+		}
+		payload, err := base64.StdEncoding.DecodeString(env.Payload)
+		if err != nil {
+			return SBOM{}, ErrNotSBOM
+		}
+		return ParseSBOM(payload)
+	case probe["predicateType"] != nil:
+		var st inTotoStatement
+		if err := json.Unmarshal(data, &st); err != nil || len(st.Predicate) == 0 {
+			return SBOM{}, ErrNotSBOM
+		}
+		return ParseSBOM(st.Predicate)
+	case probe["spdxVersion"] != nil:
+		return parseSPDX(data)
+	case probe["bomFormat"] != nil:
+		return parseCycloneDX(data)
+	}
+	return SBOM{}, ErrNotSBOM
+}
+
+func parseSPDX(data []byte) (SBOM, error) {
+	var doc spdxDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return SBOM{}, fmt.Errorf("invalid SPDX document: %w", err)
+	}
+	sbom := SBOM{Format: doc.SPDXVersion, Name: doc.Name, Packages: []SBOMPackage{}}
+	for _, p := range doc.Packages {
+		pkg := SBOMPackage{Name: p.Name, Version: p.VersionInfo, License: spdxLicense(p.LicenseConcluded)}
+		if pkg.License == "" {
+			pkg.License = spdxLicense(p.LicenseDeclared)
+		}
+		for _, r := range p.ExternalRefs {
+			if r.ReferenceType == "purl" {
+				pkg.PURL = r.ReferenceLocator
+				break
+			}
+		}
+		sbom.Packages = append(sbom.Packages, pkg)
+	}
+	sortPackages(sbom.Packages)
+	return sbom, nil
+}
+
+// spdxLicense license expression without SPDX placeholders for unknown values.
+func spdxLicense(s string) string {
+	if s == "NOASSERTION" || s == "NONE" {
+		return ""
+	}
+	return s
+}
+
+func parseCycloneDX(data []byte) (SBOM, error) {
+	var doc cycloneDXDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return SBOM{}, fmt.Errorf("invalid CycloneDX document: %w", err)
+	}
+	if doc.BOMFormat != "CycloneDX" {
+		return SBOM{}, ErrNotSBOM
+	}
+	sbom := SBOM{Format: "CycloneDX " + doc.SpecVersion, Name: doc.Metadata.Component.Name, Packages: []SBOMPackage{}}
+	var walk func([]cycloneDXComponent)
+	walk = func(components []cycloneDXComponent) {
+		for _, comp := range components {
+			pkg := SBOMPackage{Name: comp.Name, Version: comp.Version, PURL: comp.PURL}
+			if comp.Group != "" {
+				pkg.Name = comp.Group + "/" + comp.Name
+			}
+			licenses := []string{}
+			for _, l := range comp.Licenses {
+				switch {
+				case l.Expression != "":
+					licenses = append(licenses, l.Expression)
+				case l.License.ID != "":
+					licenses = append(licenses, l.License.ID)
+				case l.License.Name != "":
+					licenses = append(licenses, l.License.Name)
+				}
+			}
+			pkg.License = strings.Join(licenses, ", ")
+			sbom.Packages = append(sbom.Packages, pkg)
+			walk(comp.Components)
+		}
+	}
+	walk(doc.Components)
+	sortPackages(sbom.Packages)
+	return sbom, nil
+}
+
+func sortPackages(packages []SBOMPackage) {
+	sort.SliceStable(packages, func(i, j int) bool {
+		if packages[i].Name != packages[j].Name {
+			return packages[i].Name < packages[j].Name
+		}
+		return packages[i].Version < packages[j].Version
+	})
+}
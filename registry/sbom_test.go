@@ -0,0 +1,79 @@
+package registry
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+const testSPDX = `{
+  "spdxVersion": "SPDX-2.3",
+  "name": "alpine",
+  "packages": [
+    {"name": "musl", "versionInfo": "1.2.4", "licenseConcluded": "NOASSERTION", "licenseDeclared": "MIT",
+     "externalRefs": [{"referenceType": "cpe23Type", "referenceLocator": "cpe:2.3:a:musl"},
+                      {"referenceType": "purl", "referenceLocator": "pkg:apk/alpine/musl@1.2.4"}]},
+    {"name": "busybox", "versionInfo": "1.36.1", "licenseConcluded": "GPL-2.0-only"}
+  ]
+}`
+
+const testCycloneDX = `{
+  "bomFormat": "CycloneDX",
+  "specVersion": "1.5",
+  "metadata": {"component": {"name": "app"}},
+  "components": [
+    {"name": "lodash", "version": "4.17.21", "purl": "pkg:npm/lodash@4.17.21", "licenses": [{"license": {"id": "MIT"}}],
+     "components": [{"name": "core", "group": "org.example", "version": "1.0", "licenses": [{"expression": "MIT OR Apache-2.0"}]}]}
+  ]
+}`
+
+func TestParseSBOM(t *testing.T) {
+	convey.Convey("Parse SPDX document", t, func() {
+		sbom, err := ParseSBOM([]byte(testSPDX))
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(sbom.Format, convey.ShouldEqual, "SPDX-2.3")
+		convey.So(sbom.Name, convey.ShouldEqual, "alpine")
+		convey.So(sbom.Packages, convey.ShouldResemble, []SBOMPackage{
+			{Name: "busybox", Version: "1.36.1", License: "GPL-2.0-only"},
+			{Name: "musl", Version: "1.2.4", License: "MIT", PURL: "pkg:apk/alpine/musl@1.2.4"},
+		})
+	})
+
+	convey.Convey("Parse CycloneDX document with nested components", t, func() {
+		sbom, err := ParseSBOM([]byte(testCycloneDX))
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(sbom.Format, convey.ShouldEqual, "CycloneDX 1.5")
+		convey.So(sbom.Name, convey.ShouldEqual, "app")
+		convey.So(sbom.Packages, convey.ShouldResemble, []SBOMPackage{
+			{Name: "lodash", Version: "4.17.21", License: "MIT", PURL: "pkg:npm/lodash@4.17.21"},
+			{Name: "org.example/core", Version: "1.0", License: "MIT OR Apache-2.0"},
+		})
+	})
+
+	convey.Convey("Parse SBOM attestation in DSSE envelope", t, func() {
+		statement := `{"_type": "https://in-toto.io/Statement/v0.1", "predicateType": "https://spdx.dev/Document", "predicate": ` + testSPDX + `}`
+		envelope := `{"payloadType": "application/vnd.in-toto+json", "payload": "` + base64.StdEncoding.EncodeToString([]byte(statement)) + `", "signatures": []}`
+		sbom, err := ParseSBOM([]byte(envelope))
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(sbom.Packages, convey.ShouldHaveLength, 2)
+
+		// Predicate encoded as a string.
+		sbom, err = ParseSBOM([]byte(`{"predicateType": "https://cyclonedx.org/bom", "predicate": ` + quote(testCycloneDX) + `}`))
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(sbom.Packages, convey.ShouldHaveLength, 2)
+	})
+
+	convey.Convey("Reject other documents", t, func() {
+		_, err := ParseSBOM([]byte(`{"predicateType": "https://slsa.dev/provenance/v1", "predicate": {"buildDefinition": {}}}`))
+		convey.So(err, convey.ShouldEqual, ErrNotSBOM)
+		_, err = ParseSBOM([]byte(`not json`))
+		convey.So(err, convey.ShouldEqual, ErrNotSBOM)
+	})
+}
+
+func quote(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
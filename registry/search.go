@@ -0,0 +1,102 @@
+package registry
+
+import (
+	"sort"
+	"strings"
+)
+
+// SearchTag tag matching the search query.
+type SearchTag struct {
+	Repo string `json:"repo"`
+	Tag  string `json:"tag"`
+}
+
+// SearchLabel image label matching the search query by key or value.
+type SearchLabel struct {
+	Repo   string `json:"repo"`
+	Tag    string `json:"tag"`
+	Digest string `json:"digest"`
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+}
+
+// SearchResults repos, tags and labels matching the search query.
+type SearchResults struct {
+	Repos  []string      `json:"repos"`
+	Tags   []SearchTag   `json:"tags"`
+	Labels []SearchLabel `json:"labels"`
+	// Truncated is set when any of the results is cut at the limit.
+	Truncated bool `json:"truncated"`
+}
+
+// Search find repos, tags and image labels containing the query, case-insensitive.
+// Only the cached data is searched: tags are known once the repo is listed or counted
+// and labels once the tag details are loaded, e.g. on the tag list.
+func (c *Client) Search(query string, limit int) SearchResults {
+	q := strings.ToLower(query)
+	res := SearchResults{Repos: []string{}, Tags: []SearchTag{}, Labels: []SearchLabel{}}
+	if q == "" {
+		return res
+	}
+
+	for _, r := range c.GetRepos() {
+		if strings.Contains(strings.ToLower(r), q) {
+			res.Repos = append(res.Repos, r)
+		}
+	}
+
+	// Details of the deleted tags may still be cached, so labels are searched only for the known tags.
+	known := map[string]bool{}
+	c.tagCountsMux.Lock()
+	for repo, tags := range c.repoTags {
+		for _, t := range tags {
+			known[repo+":"+t] = true
+			if strings.Contains(strings.ToLower(t), q) {
+				res.Tags = append(res.Tags, SearchTag{Repo: repo, Tag: t})
+			}
+		}
+	}
+	c.tagCountsMux.Unlock()
+
+	c.tagDetailsMux.RLock()
+	for key, d := range c.tagDetails {
+		if !known[key] {
+			continue
+		}
+		for k, v := range d.Labels {
+			if strings.Contains(strings.ToLower(k), q) || strings.Contains(strings.ToLower(v), q) {
+				res.Labels = append(res.Labels, SearchLabel{Repo: strings.TrimSuffix(key, ":"+d.Tag), Tag: d.Tag, Digest: d.Digest, Key: k, Value: v})
+			}
+		}
+	}
+	c.tagDetailsMux.RUnlock()
+
+	sort.Slice(res.Tags, func(i, j int) bool {
+		if res.Tags[i].Repo != res.Tags[j].Repo {
+			return res.Tags[i].Repo < res.Tags[j].Repo
+		}
+		return res.Tags[i].Tag < res.Tags[j].Tag
+	})
+	sort.Slice(res.Labels, func(i, j int) bool {
+		a, b := res.Labels[i], res.Labels[j]
+		if a.Repo != b.Repo {
+			return a.Repo < b.Repo
+		}
+		if a.Tag != b.Tag {
+			return a.Tag < b.Tag
+		}
+		return a.Key < b.Key
+	})
+	if limit > 0 {
+		if len(res.Repos) > limit {
+			res.Repos, res.Truncated = res.Repos[:limit], true
+		}
+		if len(res.Tags) > limit {
+			res.Tags, res.Truncated = res.Tags[:limit], true
+		}
+		if len(res.Labels) > limit {
+			res.Labels, res.Truncated = res.Labels[:limit], true
+		}
+	}
+	return res
+}
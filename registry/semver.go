@@ -0,0 +1,145 @@
+package registry
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// semverRegexp tag as semantic version with optional "v" prefix, build metadata is not allowed in tags.
+var semverRegexp = regexp.MustCompile(`^v?(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)(?:-([0-9A-Za-z.-]+))?$`)
+
+// semver parsed semantic version of the tag.
+type semver struct {
+	major, minor, patch int
+	prerelease          string
+}
+
+// parseSemver parse the tag as semantic version such as 1.2.3, v1.2.3 or 1.2.3-rc.1.
+func parseSemver(tag string) (semver, bool) {
+	m := semverRegexp.FindStringSubmatch(tag)
+	if m == nil {
+		return semver{}, false
+	}
+	v := semver{prerelease: m[4]}
+	var err error
+	if v.major, err = strconv.Atoi(m[1]); err != nil {
+		return semver{}, false
+	}
+	if v.minor, err = strconv.Atoi(m[2]); err != nil {
+		return semver{}, false
+	}
+	if v.patch, err = strconv.Atoi(m[3]); err != nil {
+		return semver{}, false
+	}
+	return v, true
+}
+
+// less whether the version has lower precedence than the other one.
+func (v semver) less(o semver) bool {
+	if v.major != o.major {
+		return v.major < o.major
+	}
+	if v.minor != o.minor {
+		return v.minor < o.minor
+	}
+	if v.patch != o.patch {
+		return v.patch < o.patch
+	}
+	return comparePrerelease(v.prerelease, o.prerelease) < 0
+}
+
+// comparePrerelease compare pre-release versions by semver precedence, the release is higher than any pre-release.
+func comparePrerelease(a, b string) int {
+	switch {
+	case a == b:
+		return 0
+	case a == "":
+		return 1
+	case b == "":
+		return -1
+	}
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		ai, aErr := strconv.Atoi(as[i])
+		bi, bErr := strconv.Atoi(bs[i])
+		switch {
+		case aErr == nil && bErr == nil:
+			if ai != bi {
+				return compareInts(ai, bi)
+			}
+		case aErr == nil:
+			// Numeric identifiers have lower precedence than alphanumeric ones.
+			return -1
+		case bErr == nil:
+			return 1
+		case as[i] != bs[i]:
+			if as[i] < bs[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return compareInts(len(as), len(bs))
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// semverKeepTags tags protected by the semver rules with the reason, the tags which are not release versions are ignored.
+// The created time is not taken into account, so the images rebuilt from old commits are ordered by their version.
+func semverKeepTags(tags timeSlice, rules PurgeRules) map[string]string {
+	keep := map[string]string{}
+	if rules.KeepSemverPatches <= 0 && !rules.KeepSemverLatest {
+		return keep
+	}
+
+	type version struct {
+		tag string
+		v   semver
+	}
+	releases := []version{}
+	for _, tag := range tags {
+		if v, ok := parseSemver(tag.name); ok && v.prerelease == "" {
+			releases = append(releases, version{tag.name, v})
+		}
+	}
+	// From the highest to the lowest version.
+	sort.SliceStable(releases, func(i, j int) bool { return releases[j].v.less(releases[i].v) })
+
+	if rules.KeepSemverLatest {
+		// All the tags of the highest version, e.g. both 2.0.0 and v2.0.0.
+		for _, r := range releases {
+			if r.v.less(releases[0].v) {
+				break
+			}
+			keep[r.tag] = "highest semver release"
+		}
+	}
+	if rules.KeepSemverPatches > 0 {
+		// The same version may be tagged as both 1.2.3 and v1.2.3, count it once.
+		patches := map[[2]int][]int{}
+		for _, r := range releases {
+			line := [2]int{r.v.major, r.v.minor}
+			n := len(patches[line])
+			if n > 0 && patches[line][n-1] == r.v.patch {
+				n--
+			} else {
+				patches[line] = append(patches[line], r.v.patch)
+			}
+			if _, ok := keep[r.tag]; !ok && n < rules.KeepSemverPatches {
+				keep[r.tag] = fmt.Sprintf("latest %d semver patches of %d.%d", rules.KeepSemverPatches, r.v.major, r.v.minor)
+			}
+		}
+	}
+	return keep
+}
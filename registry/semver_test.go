@@ -0,0 +1,56 @@
+package registry
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestSemver(t *testing.T) {
+	convey.Convey("Parse tags as semantic versions", t, func() {
+		v, ok := parseSemver("v1.20.3-rc.1")
+		convey.So(ok, convey.ShouldBeTrue)
+		convey.So(v, convey.ShouldResemble, semver{major: 1, minor: 20, patch: 3, prerelease: "rc.1"})
+		for _, tag := range []string{"latest", "1.2", "1.2.3.4", "01.2.3", "1.2.3-", "V1.2.3", "1.2.3_rc1"} {
+			_, ok := parseSemver(tag)
+			convey.So(ok, convey.ShouldBeFalse)
+		}
+
+		tags := []string{"1.0.0", "1.0.0-rc.1", "1.0.0-alpha.beta", "1.0.0-beta.11", "1.0.0-alpha", "1.0.0-beta",
+			"1.0.0-beta.2", "1.0.0-alpha.1", "0.9.10", "0.9.9", "2.0.0"}
+		sort.Slice(tags, func(i, j int) bool {
+			vi, _ := parseSemver(tags[i])
+			vj, _ := parseSemver(tags[j])
+			return vi.less(vj)
+		})
+		convey.So(tags, convey.ShouldResemble, []string{"0.9.9", "0.9.10", "1.0.0-alpha", "1.0.0-alpha.1",
+			"1.0.0-alpha.beta", "1.0.0-beta", "1.0.0-beta.2", "1.0.0-beta.11", "1.0.0-rc.1", "1.0.0", "2.0.0"})
+	})
+
+	convey.Convey("Keep tags by semver rules", t, func() {
+		tags := timeSlice{}
+		for _, tag := range []string{"1.2.3", "v1.2.3", "1.2.2", "1.2.1", "1.3.0", "1.3.1-rc.1", "0.9.0", "latest", "2.0.0-beta"} {
+			tags = append(tags, TagData{name: tag})
+		}
+
+		convey.So(semverKeepTags(tags, PurgeRules{}), convey.ShouldBeEmpty)
+		convey.So(semverKeepTags(tags, PurgeRules{KeepSemverLatest: true}), convey.ShouldResemble,
+			map[string]string{"1.3.0": "highest semver release"})
+		convey.So(semverKeepTags(tags, PurgeRules{KeepSemverPatches: 1}), convey.ShouldResemble, map[string]string{
+			"1.3.0":  "latest 1 semver patches of 1.3",
+			"1.2.3":  "latest 1 semver patches of 1.2",
+			"v1.2.3": "latest 1 semver patches of 1.2",
+			"0.9.0":  "latest 1 semver patches of 0.9",
+		})
+		keep := semverKeepTags(tags, PurgeRules{KeepSemverPatches: 2, KeepSemverLatest: true})
+		convey.So(keep, convey.ShouldHaveLength, 5)
+		convey.So(keep["1.3.0"], convey.ShouldEqual, "highest semver release")
+		convey.So(keep["1.2.2"], convey.ShouldEqual, "latest 2 semver patches of 1.2")
+
+		// The highest version tagged in both forms.
+		tags = append(tags, TagData{name: "v2.0.0"}, TagData{name: "2.0.0"})
+		convey.So(semverKeepTags(tags, PurgeRules{KeepSemverLatest: true}), convey.ShouldResemble,
+			map[string]string{"2.0.0": "highest semver release", "v2.0.0": "highest semver release"})
+	})
+}
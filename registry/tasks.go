@@ -1,21 +1,25 @@
 package registry
 
 import (
+	"context"
 	"fmt"
 	"math"
 	"os"
-	"regexp"
 	"sort"
 	"strings"
 	"time"
 
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 	"github.com/tidwall/gjson"
 )
 
 type TagData struct {
 	name    string
+	digest  string
 	created time.Time
+	// reason why the tag is kept or purged.
+	reason string
 }
 
 func (t TagData) String() string {
@@ -41,13 +45,19 @@ func (p timeSlice) Swap(i, j int) {
 	p[i], p[j] = p[j], p[i]
 }
 
+// PulledTagsFunc lookup of the tags and digests of the repo pulled within the given number of days.
+// It is provided by the event listener which cannot be imported here.
+type PulledTagsFunc func(repo string, days int) ([]string, error)
+
 // PurgeOldTags purge old tags.
-func PurgeOldTags(client *Client, purgeDryRun bool, purgeIncludeRepos, purgeExcludeRepos string) {
+// Tags of images which cannot be inspected are never purged, however the error is returned at the end.
+// The plan with the decision about each tag is written to the purgeOutput file if set, before purging anything.
+func PurgeOldTags(ctx context.Context, client *Client, purgeDryRun bool, purgeIncludeRepos, purgeExcludeRepos, purgeOutput string,
+	pulledTags PulledTagsFunc) error {
 	logger := SetupLogging("registry.tasks.PurgeOldTags")
-	keepDays := viper.GetInt("purge_tags.keep_days")
-	keepCount := viper.GetInt("purge_tags.keep_count")
-	keepRegexp := viper.GetString("purge_tags.keep_regexp")
 	keepFromFile := viper.GetString("purge_tags.keep_from_file")
+	keepInUseFrom := viper.GetString("purge_tags.keep_in_use_from")
+	safeUntag := viper.GetBool("purge_tags.safe_untag")
 
 	dryRunText := ""
 	if purgeDryRun {
@@ -55,73 +65,107 @@ func PurgeOldTags(client *Client, purgeDryRun bool, purgeIncludeRepos, purgeExcl
 		dryRunText = "skipped"
 	}
 
+	policies, err := ReadPurgePolicies()
+	if err != nil {
+		logger.Error("Not purging anything!")
+		return err
+	}
+
 	var dataFromFile gjson.Result
 	if keepFromFile != "" {
 		if _, err := os.Stat(keepFromFile); os.IsNotExist(err) {
 			logger.Warnf("Cannot open %s: %s", keepFromFile, err)
 			logger.Error("Not purging anything!")
-			return
+			return err
 		}
 		data, err := os.ReadFile(keepFromFile)
 		if err != nil {
 			logger.Warnf("Cannot read %s: %s", keepFromFile, err)
 			logger.Error("Not purging anything!")
-			return
+			return err
 		}
 		dataFromFile = gjson.ParseBytes(data)
 	}
 
-	catalog := []string{}
-	if purgeIncludeRepos != "" {
-		logger.Infof("Including repositories: %s", purgeIncludeRepos)
-		catalog = append(catalog, strings.Split(purgeIncludeRepos, ",")...)
-	} else {
-		client.RefreshCatalog()
-		catalog = client.GetRepos()
+	catalog, err := purgeCatalog(ctx, client, logger, purgeIncludeRepos, purgeExcludeRepos)
+	if err != nil {
+		logger.Error("Not purging anything!")
+		return err
 	}
-	if purgeExcludeRepos != "" {
-		logger.Infof("Excluding repositories: %s", purgeExcludeRepos)
-		tmpCatalog := []string{}
-		for _, repo := range catalog {
-			if !ItemInSlice(repo, strings.Split(purgeExcludeRepos, ",")) {
-				tmpCatalog = append(tmpCatalog, repo)
-			}
+	logger.Infof("Working on repositories: %s", catalog)
+
+	// Digests of the images in use per repo with the references to them.
+	inUse := map[string]map[string][]string{}
+	if keepInUseFrom != "" {
+		images, err := ReadInUseImages(keepInUseFrom)
+		if err == nil {
+			inUse, err = client.ResolveInUseDigests(ctx, images, catalog)
 		}
-		catalog = tmpCatalog
+		if err != nil {
+			logger.Errorf("Cannot read images in use from %s: %s", keepInUseFrom, err)
+			logger.Error("Not purging anything!")
+			return err
+		}
+		logger.Infof("Found %d image references in use in %s.", len(images), keepInUseFrom)
 	}
-	logger.Infof("Working on repositories: %s", catalog)
 
 	now := time.Now().UTC()
 	repos := map[string]timeSlice{}
+	// Tags with zero creation time are never purged.
+	zeroTimeTags := map[string]timeSlice{}
+	// Repos and tags which are not evaluated, the tag name is empty for the whole repo.
+	skipTags := map[string]timeSlice{}
+	// The number of tags pointing to the digest per repo.
+	digestTags := map[string]map[string]int{}
 	count := 0
+	errCount := 0
 	for _, repo := range catalog {
-		tags := client.ListTags(repo)
+		if rules := policies.For(repo); rules.Exclude {
+			logger.Infof("[%s] excluded by purge policy %s", repo, rules.Policy)
+			skipTags[repo] = append(skipTags[repo], TagData{reason: "excluded by purge policy " + rules.Policy})
+			continue
+		}
+		tags, err := client.ListTags(ctx, repo)
+		if err != nil {
+			logger.Errorf("[%s] cannot list tags, skipping the repo: %s", repo, err)
+			skipTags[repo] = append(skipTags[repo], TagData{reason: "cannot list tags: " + err.Error()})
+			errCount++
+			continue
+		}
 		if len(tags) == 0 {
+			skipTags[repo] = append(skipTags[repo], TagData{reason: "no tags"})
 			continue
 		}
 		logger.Infof("[%s] scanning %d tags...", repo, len(tags))
 		for _, tag := range tags {
-			imageRef := repo + ":" + tag
-			created := client.GetImageCreated(imageRef)
-			if created.IsZero() {
+			details, err := client.GetTagDetails(ctx, repo, tag)
+			if err != nil {
+				// Unknown age, so never purge it.
+				logger.Errorf("[%s] cannot get created time of tag %s, skipping it: %s", repo, tag, err)
+				skipTags[repo] = append(skipTags[repo], TagData{name: tag, reason: "cannot get created time: " + err.Error()})
+				errCount++
+				continue
+			}
+			if digestTags[repo] == nil {
+				digestTags[repo] = map[string]int{}
+			}
+			digestTags[repo][details.Digest]++
+			if details.Created.IsZero() {
 				// Image manifest with zero creation time, e.g. cosign w/o --record-creation-timestamp
 				logger.Debugf("[%s] tag with zero creation time: %s", repo, tag)
+				zeroTimeTags[repo] = append(zeroTimeTags[repo], TagData{name: tag, digest: details.Digest, reason: "zero creation time"})
 				continue
 			}
-			repos[repo] = append(repos[repo], TagData{name: tag, created: created})
+			repos[repo] = append(repos[repo], TagData{name: tag, digest: details.Digest, created: details.Created})
 		}
 	}
 
 	logger.Infof("Scanned %d repositories.", len(catalog))
-	logger.Infof("Filtering out tags for purging: keep %d days, keep count %d", keepDays, keepCount)
-	if keepRegexp != "" {
-		logger.Infof("Keeping tags matching regexp: %s", keepRegexp)
-	}
 	if keepFromFile != "" {
 		logger.Infof("Keeping tags from file: %+v", dataFromFile)
 	}
-	purgeTags := map[string][]string{}
-	keepTags := map[string][]string{}
+	purgeTags := map[string]timeSlice{}
+	keepTags := map[string]timeSlice{}
 	count = 0
 	for _, repo := range SortedMapKeys(repos) {
 		// Sort tags by "created" from newest to oldest.
@@ -133,28 +177,26 @@ func PurgeOldTags(client *Client, purgeDryRun bool, purgeIncludeRepos, purgeExcl
 			tagsFromFile = append(tagsFromFile, i.String())
 		}
 
-		// Filter out tags
-		for _, tag := range repos[repo] {
-			daysOld := int(now.Sub(tag.created).Hours() / 24)
-			matchByRegexp := false
-			if keepRegexp != "" {
-				matchByRegexp, _ = regexp.MatchString(keepRegexp, tag.name)
-			}
-
-			if daysOld > keepDays && !matchByRegexp && !ItemInSlice(tag.name, tagsFromFile) {
-				purgeTags[repo] = append(purgeTags[repo], tag.name)
-			} else {
-				keepTags[repo] = append(keepTags[repo], tag.name)
+		rules := policies.For(repo)
+		logger.Infof("[%s] Filtering out tags for purging, %s", repo, rules)
+		pulled := []string{}
+		if rules.KeepIfPulledWithinDays > 0 {
+			var err error
+			if pulled, err = pulledTags(repo, rules.KeepIfPulledWithinDays); err != nil {
+				// Unknown pulls, so never purge the repo.
+				logger.Errorf("[%s] cannot get pulled tags from the event log, skipping the repo: %s", repo, err)
+				skipTags[repo] = append(skipTags[repo], TagData{reason: "cannot get pulled tags from the event log: " + err.Error()})
+				errCount++
+				continue
 			}
+			logger.Infof("[%s] Pulled within %d days: %v", repo, rules.KeepIfPulledWithinDays, pulled)
 		}
-
-		// Keep minimal count of tags no matter how old they are.
-		if len(keepTags[repo]) < keepCount {
-			// At least "threshold"-"keep" but not more than available for "purge".
-			takeFromPurge := int(math.Min(float64(keepCount-len(keepTags[repo])), float64(len(purgeTags[repo]))))
-			keepTags[repo] = append(keepTags[repo], purgeTags[repo][:takeFromPurge]...)
-			purgeTags[repo] = purgeTags[repo][takeFromPurge:]
+		for _, tag := range repos[repo] {
+			if sources, ok := inUse[repo][tag.digest]; ok {
+				logger.Infof("[%s] Keeping tag %s in use by %s", repo, tag.name, strings.Join(sources, ", "))
+			}
 		}
+		keepTags[repo], purgeTags[repo] = filterTags(repos[repo], rules, tagsFromFile, pulled, inUse[repo], now)
 
 		count = count + len(purgeTags[repo])
 		logger.Infof("[%s] All %d: %v", repo, len(repos[repo]), repos[repo])
@@ -162,6 +204,28 @@ func PurgeOldTags(client *Client, purgeDryRun bool, purgeIncludeRepos, purgeExcl
 		logger.Infof("[%s] Purge %d: %v", repo, len(purgeTags[repo]), purgeTags[repo])
 	}
 
+	if purgeOutput != "" {
+		plan := []PurgePlanEntry{}
+		for _, repo := range catalog {
+			policy := policies.For(repo).Policy
+			for _, action := range []struct {
+				name string
+				tags timeSlice
+			}{{PlanKeep, keepTags[repo]}, {PlanKeep, zeroTimeTags[repo]}, {PlanPurge, purgeTags[repo]}, {PlanSkip, skipTags[repo]}} {
+				for _, tag := range action.tags {
+					plan = append(plan, PurgePlanEntry{Registry: client.Name(), Repo: repo, Tag: tag.name, Digest: tag.digest,
+						Created: tag.created, Action: action.name, Policy: policy, Reason: tag.reason})
+				}
+			}
+		}
+		if err := WritePurgePlan(purgeOutput, plan); err != nil {
+			logger.Errorf("Cannot write purge plan to %s: %s", purgeOutput, err)
+			logger.Error("Not purging anything!")
+			return err
+		}
+		logger.Infof("Purge plan with %d tags has been written to %s.", len(plan), purgeOutput)
+	}
+
 	logger.Infof("There are %d tags to purge.", count)
 	if count > 0 {
 		logger.Info("Purging old tags...")
@@ -176,8 +240,99 @@ func PurgeOldTags(client *Client, purgeDryRun bool, purgeIncludeRepos, purgeExcl
 			continue
 		}
 		for _, tag := range purgeTags[repo] {
-			client.DeleteTag(repo, tag)
+			var err error
+			if safeUntag && digestTags[repo][tag.digest] > 1 {
+				// The other tags of the same image are kept, they are purged on their own if needed.
+				_, err = client.UntagSharedTag(ctx, repo, tag.name)
+			} else {
+				err = client.DeleteTag(ctx, repo, tag.name)
+			}
+			if err != nil {
+				errCount++
+				continue
+			}
+			digestTags[repo][tag.digest]--
 		}
 	}
+	if errCount > 0 {
+		return fmt.Errorf("purging finished with %d errors, see the log above", errCount)
+	}
 	logger.Info("Done.")
+	return nil
+}
+
+// purgeCatalog list of repos to purge tags from, the whole catalog unless the repos are included explicitly.
+func purgeCatalog(ctx context.Context, client *Client, logger *logrus.Entry, purgeIncludeRepos, purgeExcludeRepos string) ([]string, error) {
+	catalog := []string{}
+	if purgeIncludeRepos != "" {
+		logger.Infof("Including repositories: %s", purgeIncludeRepos)
+		catalog = append(catalog, strings.Split(purgeIncludeRepos, ",")...)
+	} else {
+		if err := client.RefreshCatalog(ctx); err != nil {
+			return nil, err
+		}
+		catalog = client.GetRepos()
+	}
+	if purgeExcludeRepos != "" {
+		logger.Infof("Excluding repositories: %s", purgeExcludeRepos)
+		tmpCatalog := []string{}
+		for _, repo := range catalog {
+			if !ItemInSlice(repo, strings.Split(purgeExcludeRepos, ",")) {
+				tmpCatalog = append(tmpCatalog, repo)
+			}
+		}
+		catalog = tmpCatalog
+	}
+	return catalog, nil
+}
+
+// filterTags split the tags sorted from newest to oldest into the ones to keep and to purge by the rules,
+// the reason of the decision is set for each tag.
+// Pulled are the tags and digests pulled recently, tags of the pulled digests are kept too.
+// Tags of the digests in use are always kept.
+func filterTags(tags timeSlice, rules PurgeRules, tagsFromFile, pulled []string, inUse map[string][]string, now time.Time) (timeSlice, timeSlice) {
+	keep, purge := timeSlice{}, timeSlice{}
+	keepBySemver := semverKeepTags(tags, rules)
+	for _, tag := range tags {
+		daysOld := int(now.Sub(tag.created).Hours() / 24)
+		keepRegexp := ""
+		for _, re := range rules.KeepRegexps {
+			if re.MatchString(tag.name) {
+				keepRegexp = re.String()
+				break
+			}
+		}
+
+		switch {
+		case len(inUse[tag.digest]) > 0:
+			tag.reason = "in use by " + strings.Join(inUse[tag.digest], ", ")
+		case ItemInSlice(tag.name, tagsFromFile):
+			tag.reason = "listed in keep_from_file"
+		case ItemInSlice(tag.name, pulled) || ItemInSlice(tag.digest, pulled):
+			tag.reason = fmt.Sprintf("pulled within %d days", rules.KeepIfPulledWithinDays)
+		case keepBySemver[tag.name] != "":
+			tag.reason = keepBySemver[tag.name]
+		case keepRegexp != "":
+			tag.reason = "matches keep regexp " + keepRegexp
+		case daysOld <= rules.KeepDays:
+			tag.reason = fmt.Sprintf("not older than %d days", rules.KeepDays)
+		default:
+			tag.reason = fmt.Sprintf("older than %d days", rules.KeepDays)
+			purge = append(purge, tag)
+			continue
+		}
+		keep = append(keep, tag)
+	}
+
+	// Keep minimal count of tags no matter how old they are.
+	if len(keep) < rules.KeepCount {
+		// At least "threshold"-"keep" but not more than available for "purge".
+		takeFromPurge := int(math.Min(float64(rules.KeepCount-len(keep)), float64(len(purge))))
+		for _, tag := range purge[:takeFromPurge] {
+			tag.reason = fmt.Sprintf("within keep count %d", rules.KeepCount)
+			keep = append(keep, tag)
+		}
+		purge = purge[takeFromPurge:]
+	}
+	return keep, purge
 }
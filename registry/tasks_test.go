@@ -0,0 +1,107 @@
+package registry
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestFilterTags(t *testing.T) {
+	convey.Convey("Split tags into the ones to keep and to purge", t, func() {
+		now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+		tags := timeSlice{
+			{name: "5", created: now.AddDate(0, 0, -1)},
+			{name: "4", created: now.AddDate(0, 0, -20)},
+			{name: "release-3", created: now.AddDate(0, 0, -40)},
+			{name: "2", created: now.AddDate(0, 0, -60)},
+			{name: "1", created: now.AddDate(0, 0, -80)},
+		}
+		names := func(tags timeSlice) []string {
+			res := []string{}
+			for _, t := range tags {
+				res = append(res, t.name)
+			}
+			return res
+		}
+
+		keep, purge := filterTags(tags, PurgeRules{KeepDays: 30}, nil, nil, nil, now)
+		convey.So(names(keep), convey.ShouldResemble, []string{"5", "4"})
+		convey.So(names(purge), convey.ShouldResemble, []string{"release-3", "2", "1"})
+
+		keep, purge = filterTags(tags, PurgeRules{KeepDays: 30, KeepCount: 4}, nil, nil, nil, now)
+		convey.So(names(keep), convey.ShouldResemble, []string{"5", "4", "release-3", "2"})
+		convey.So(names(purge), convey.ShouldResemble, []string{"1"})
+
+		rules := PurgeRules{KeepDays: 10, KeepRegexps: []*regexp.Regexp{regexp.MustCompile("^release-")}}
+		keep, purge = filterTags(tags, rules, []string{"1"}, nil, nil, now)
+		convey.So(names(keep), convey.ShouldResemble, []string{"5", "release-3", "1"})
+		convey.So(names(purge), convey.ShouldResemble, []string{"4", "2"})
+
+		// Pulled by tag or by digest.
+		tags[3].digest = "sha256:2"
+		keep, purge = filterTags(tags, PurgeRules{KeepDays: 10, KeepIfPulledWithinDays: 30}, nil, []string{"4", "sha256:2"}, nil, now)
+		convey.So(names(keep), convey.ShouldResemble, []string{"5", "4", "2"})
+		convey.So(names(purge), convey.ShouldResemble, []string{"release-3", "1"})
+
+		inUse := map[string][]string{"sha256:2": {"pods.json Pod/default/app (example.com/a/b:2)"}}
+		keep, purge = filterTags(tags, PurgeRules{KeepDays: 10}, nil, nil, inUse, now)
+		convey.So(names(keep), convey.ShouldResemble, []string{"5", "2"})
+		convey.So(names(purge), convey.ShouldResemble, []string{"4", "release-3", "1"})
+	})
+
+	convey.Convey("Give the reason for each tag", t, func() {
+		now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+		tags := timeSlice{
+			{name: "latest", digest: "sha256:5", created: now.AddDate(0, 0, -1)},
+			{name: "4", digest: "sha256:4", created: now.AddDate(0, 0, -20)},
+			{name: "1.2.0", digest: "sha256:3", created: now.AddDate(0, 0, -40)},
+			{name: "2", digest: "sha256:2", created: now.AddDate(0, 0, -60)},
+			{name: "1", digest: "sha256:1", created: now.AddDate(0, 0, -80)},
+			{name: "0", digest: "sha256:0", created: now.AddDate(0, 0, -90)},
+		}
+		rules := PurgeRules{KeepDays: 10, KeepCount: 5, KeepRegexps: []*regexp.Regexp{regexp.MustCompile("^latest$")},
+			KeepSemverLatest: true, KeepIfPulledWithinDays: 7}
+		inUse := map[string][]string{"sha256:1": {"pods.json Pod/prod/app (example.com/a/b:1)"}}
+		keep, purge := filterTags(tags, rules, []string{"2"}, []string{"sha256:4"}, inUse, now)
+		reasons := map[string]string{}
+		for _, tag := range append(keep, purge...) {
+			reasons[tag.name] = tag.reason
+		}
+		convey.So(reasons, convey.ShouldResemble, map[string]string{
+			"latest": "matches keep regexp ^latest$",
+			"4":      "pulled within 7 days",
+			"1.2.0":  "highest semver release",
+			"2":      "listed in keep_from_file",
+			"1":      "in use by pods.json Pod/prod/app (example.com/a/b:1)",
+			"0":      "older than 10 days",
+		})
+
+		rules.KeepRegexps = nil
+		keep, purge = filterTags(tags, rules, nil, nil, nil, now)
+		convey.So(keep[0].reason, convey.ShouldEqual, "not older than 10 days")
+		convey.So(keep[len(keep)-1].reason, convey.ShouldEqual, "within keep count 5")
+		convey.So(purge, convey.ShouldHaveLength, 1)
+	})
+
+	convey.Convey("Keep semver tags no matter how old", t, func() {
+		now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+		// 1.4.1 is rebuilt from an old commit after 2.1.0.
+		tags := timeSlice{
+			{name: "1.4.1", created: now.AddDate(0, 0, -100)},
+			{name: "2.1.0", created: now.AddDate(0, 0, -110)},
+			{name: "2.0.1", created: now.AddDate(0, 0, -120)},
+			{name: "2.0.0", created: now.AddDate(0, 0, -130)},
+			{name: "1.4.0", created: now.AddDate(0, 0, -140)},
+		}
+		keep, purge := filterTags(tags, PurgeRules{KeepDays: 30, KeepCount: 1, KeepSemverLatest: true}, nil, nil, nil, now)
+		convey.So(len(keep), convey.ShouldEqual, 1)
+		convey.So(keep[0].name, convey.ShouldEqual, "2.1.0")
+		convey.So(len(purge), convey.ShouldEqual, 4)
+
+		keep, _ = filterTags(tags, PurgeRules{KeepDays: 30, KeepSemverPatches: 1}, nil, nil, nil, now)
+		convey.So(len(keep), convey.ShouldEqual, 3)
+		convey.So([]string{keep[0].name, keep[1].name, keep[2].name}, convey.ShouldResemble, []string{"1.4.1", "2.1.0", "2.0.1"})
+	})
+}
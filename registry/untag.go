@@ -0,0 +1,93 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+)
+
+// UntagMethod how the tag was deleted by UntagTag.
+type UntagMethod string
+
+const (
+	// UntagByDigest no other tags point to the image, so it was deleted by digest.
+	UntagByDigest UntagMethod = "digest"
+	// UntagByTag the tag was deleted with OCI tag deletion.
+	UntagByTag UntagMethod = "tag"
+	// UntagByPlaceholder the tag was re-pointed to a placeholder image which was deleted by digest.
+	UntagByPlaceholder UntagMethod = "placeholder"
+)
+
+// placeholderLabel label of the placeholder image making its digest unique.
+const placeholderLabel = "io.github.quiq.registry-ui.untag"
+
+// UntagTag delete the tag keeping the other tags pointing to the same digest.
+// If there are no such tags, the image is deleted by digest as DeleteTag does.
+// Otherwise, the tag is deleted with OCI tag deletion when the registry supports it,
+// or re-pointed to a placeholder image which is deleted by digest then.
+func (c *Client) UntagTag(ctx context.Context, repoPath, tag string) (UntagMethod, error) {
+	d, err := c.GetTagDetails(ctx, repoPath, tag)
+	if err != nil {
+		return "", err
+	}
+	// Unlike GetTagAliases, all tags are checked on the registry as another tag may point to the image by now.
+	digestTags, err := c.getDigestTags(ctx, repoPath)
+	if err != nil {
+		return "", err
+	}
+	if aliases := digestTags[d.Digest]; len(aliases) == 1 && aliases[0] == tag {
+		return UntagByDigest, c.DeleteTag(ctx, repoPath, tag)
+	}
+	return c.UntagSharedTag(ctx, repoPath, tag)
+}
+
+// UntagSharedTag delete the tag which is known to share the digest with other tags, so the image is never
+// deleted by digest. OCI tag deletion is used when the registry supports it, otherwise the placeholder image.
+func (c *Client) UntagSharedTag(ctx context.Context, repoPath, tag string) (UntagMethod, error) {
+	ctx, cancel := withTimeout(ctx, c.timeouts.deleteTag)
+	defer cancel()
+	imageRef := repoPath + ":" + tag
+	ref, err := name.NewTag(c.hostname+"/"+imageRef, c.nameOptions...)
+	if err != nil {
+		c.logger.Errorf("Error parsing image reference %s: %s", imageRef, err)
+		return "", err
+	}
+
+	err = c.getPusher().Delete(ctx, ref)
+	if err == nil {
+		c.forgetTag(repoPath, tag)
+		c.logger.Infof("Tag %s has been successfully deleted, other tags of the image are kept.", imageRef)
+		return UntagByTag, nil
+	}
+	err = wrapError(err)
+	if !isUnsupported(err) {
+		c.logger.Errorf("Error deleting tag %s: %s", imageRef, err)
+		return "", err
+	}
+
+	c.logger.Warnf("Registry does not support deleting tags (%s), re-pointing %s to a placeholder image to delete it.", err, imageRef)
+	img, err := mutate.Config(empty.Image, v1.Config{Labels: map[string]string{placeholderLabel: imageRef + "@" + time.Now().UTC().Format(time.RFC3339Nano)}})
+	if err != nil {
+		return "", err
+	}
+	digest, err := img.Digest()
+	if err != nil {
+		return "", err
+	}
+	if err := c.getPusher().Push(ctx, ref, img); err != nil {
+		c.logger.Errorf("Error pushing placeholder image to %s: %s", imageRef, err)
+		return "", wrapError(err)
+	}
+	if err := c.getPusher().Delete(ctx, ref.Context().Digest(digest.String())); err != nil {
+		c.logger.Errorf("Error deleting placeholder image %s@%s: %s", repoPath, digest, err)
+		return "", fmt.Errorf("tag %s points to the placeholder image %s which cannot be deleted: %w", imageRef, digest, wrapError(err))
+	}
+	c.forgetTag(repoPath, tag)
+	c.logger.Warnf("Tag %s has been deleted via placeholder image %s, its config blob is left until garbage collection.", imageRef, digest)
+	return UntagByPlaceholder, nil
+}
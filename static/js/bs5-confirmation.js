@@ -13,6 +13,9 @@
       btnOkClass: 'btn-sm btn-danger',
       btnCancelClass: 'btn-sm btn-secondary',
       placement: 'left',
+      // HTML shown above the buttons, or a function returning it called with the element as "this".
+      message: '',
+      onShow: function() {},
       onConfirm: function() {},
       onCancel: function() {}
     };
@@ -24,8 +27,8 @@
       var href = $element.attr('href');
       var popoverInstance = null;
 
-      // Prevent default action
-      $element.on('click', function(e) {
+      // Prevent default action, rebinding replaces the previous handler.
+      $element.off('click.confirmation').on('click.confirmation', function(e) {
         e.preventDefault();
         e.stopPropagation();
 
@@ -37,7 +40,9 @@
         }
 
         // Create popover content with buttons
-        var content = '<div class="d-grid gap-2">' +
+        var message = typeof settings.message === 'function' ? settings.message.call($element[0]) : settings.message;
+        var content = (message ? '<div class="confirm-message small mb-2">' + message + '</div>' : '') +
+          '<div class="d-grid gap-2">' +
           '<button type="button" class="btn ' + settings.btnOkClass + ' confirm-ok">' +
             settings.btnOkText +
           '</button>' +
@@ -57,6 +62,7 @@
         });
 
         popoverInstance.show();
+        settings.onShow.call($element[0], $(popoverInstance.tip));
 
         // Handle confirm button
         $(document).one('click', '.confirm-ok', function(e) {
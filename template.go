@@ -43,7 +43,6 @@ func setupRenderer(basePath string) *Template {
 
 	view.AddGlobal("version", version)
 	view.AddGlobal("basePath", basePath)
-	view.AddGlobal("registryHost", viper.GetString("registry.hostname"))
 	view.AddGlobal("pretty_size", func(val interface{}) string {
 		var s float64
 		switch i := val.(type) {
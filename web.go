@@ -1,13 +1,17 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"strings"
 
 	"github.com/CloudyKit/jet/v6"
 	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/quiq/registry-ui/events"
 	"github.com/quiq/registry-ui/registry"
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 )
 
@@ -19,94 +23,431 @@ func (a *apiClient) setUserPermissions(c echo.Context) jet.VarMap {
 	data := jet.VarMap{}
 	data.Set("user", user)
 	admins := viper.GetStringSlice("access_control.admins")
+	data.Set("isAdmin", registry.ItemInSlice(user, admins))
 	data.Set("eventsAllowed", viper.GetBool("access_control.anyone_can_view_events") || registry.ItemInSlice(user, admins))
 	data.Set("deleteAllowed", viper.GetBool("access_control.anyone_can_delete_tags") || registry.ItemInSlice(user, admins))
+	token, _ := c.Get(middleware.DefaultCSRFConfig.ContextKey).(string)
+	data.Set("csrfToken", token)
 	return data
 }
 
+type registryLink struct {
+	Name     string
+	Hostname string
+	Path     string
+}
+
+// getClientByName return registry client by name, the default one if the name is empty.
+func (a *apiClient) getClientByName(name string) *registry.Client {
+	if name == "" {
+		return a.clients[0]
+	}
+	for _, client := range a.clients {
+		if client.Name() == name {
+			return client
+		}
+	}
+	return nil
+}
+
+// getClient return registry client by the name from URL path or request params.
+func (a *apiClient) getClient(c echo.Context) (*registry.Client, error) {
+	name := c.Param("registry")
+	if name == "" {
+		name = c.FormValue("registry")
+	}
+	client := a.getClientByName(name)
+	if client == nil {
+		return nil, echo.NewHTTPError(http.StatusNotFound, "unknown registry: "+name)
+	}
+	return client, nil
+}
+
+// registryPath URL path to the catalog root of the registry.
+func (a *apiClient) registryPath(client *registry.Client) string {
+	if client == a.clients[0] {
+		return a.basePath
+	}
+	return a.basePath + "/-/" + client.Name()
+}
+
+// setRegistryData set template variables of the current registry and links to switch between registries.
+func (a *apiClient) setRegistryData(data jet.VarMap, client *registry.Client) {
+	data.Set("registryName", client.Name())
+	data.Set("registryHost", client.Hostname())
+	data.Set("registryPath", a.registryPath(client))
+	registries := []registryLink{}
+	if len(a.clients) > 1 {
+		for _, r := range a.clients {
+			registries = append(registries, registryLink{Name: r.Name(), Hostname: r.Hostname(), Path: a.registryPath(r)})
+		}
+	}
+	data.Set("registries", registries)
+	data.Set("tagsCountProgress", client.TagsCountProgress())
+}
+
 func (a *apiClient) viewCatalog(c echo.Context) error {
 	repoPath := strings.Trim(c.Param("repoPath"), "/")
 	// fmt.Println("repoPath:", repoPath)
+	client, err := a.getClient(c)
+	if err != nil {
+		return err
+	}
 
 	data := a.setUserPermissions(c)
+	a.setRegistryData(data, client)
 	data.Set("repoPath", repoPath)
-
-	showTags := false
-	showImageInfo := false
-	allRepoPaths := a.client.GetRepos()
-	repos := []string{}
-	if repoPath == "" {
-		// Show all repos
-		for _, r := range allRepoPaths {
-			repos = append(repos, strings.Split(r, "/")[0])
-		}
-	} else if strings.Contains(repoPath, ":") {
-		// Show image info
-		showImageInfo = true
-	} else {
-		for _, r := range allRepoPaths {
-			if r == repoPath {
-				// Show tags
-				showTags = true
-			}
-			if strings.HasPrefix(r, repoPath+"/") {
-				// Show sub-repos
-				r = strings.TrimPrefix(r, repoPath+"/")
-				repos = append(repos, strings.Split(r, "/")[0])
-			}
-		}
+	if flash, ok := getFlash(c, a.basePath); ok {
+		data.Set("flash", flash)
 	}
 
-	if showImageInfo {
+	if strings.Contains(repoPath, ":") {
 		// Show image info
-		imageInfo, err := a.client.GetImageInfo(repoPath)
+		imageInfo, err := client.GetImageInfo(c.Request().Context(), repoPath)
 		if err != nil {
-			basePath := viper.GetString("uri_base_path")
-			return c.Redirect(http.StatusSeeOther, basePath)
+			setFlash(c, a.basePath, "danger", fmt.Sprintf("Cannot fetch image %s: %s", repoPath, err))
+			return c.Redirect(http.StatusSeeOther, fmt.Sprintf("%s/%s", a.registryPath(client), imageRepo(repoPath)))
 		}
 		data.Set("ii", imageInfo)
+		subject, _ := registry.ArtifactTagSubject(imageInfo.ImageRefTag)
+		data.Set("artifactSubject", subject)
+		referrers, err := client.ListReferrers(c.Request().Context(), imageInfo.ImageRefRepo, imageInfo.ImageRefDigest)
+		data.Set("referrersError", "")
+		if err != nil {
+			data.Set("referrersError", err.Error())
+		}
+		data.Set("referrerGroups", registry.GroupReferrers(referrers))
+		data.Set("promotionTargets", a.getPromotionTargets(client))
 		return c.Render(http.StatusOK, "image_info.html", data)
 	} else {
 		// Show repos, tags or both.
-		repos = registry.UniqueSortedSlice(repos)
+		repos, showTags := listRepos(client, repoPath)
 		tags := []string{}
+		// Signatures, SBOMs and attestations attached by tags are hidden unless requested.
+		showArtifacts := c.QueryParam("artifacts") == "true"
+		artifactTagCount := 0
 		if showTags {
-			tags = a.client.ListTags(repoPath)
-
+			if t, err := client.ListTags(c.Request().Context(), repoPath); err != nil {
+				data.Set("errorMessage", fmt.Sprintf("Cannot list tags of %s: %s", repoPath, err))
+			} else {
+				for _, tag := range t {
+					if registry.IsArtifactTag(tag) {
+						artifactTagCount++
+						if !showArtifacts {
+							continue
+						}
+					}
+					tags = append(tags, tag)
+				}
+			}
 		}
+		data.Set("showArtifacts", showArtifacts)
+		data.Set("artifactTagCount", artifactTagCount)
 		data.Set("repos", repos)
-		data.Set("isCatalogReady", a.client.IsCatalogReady())
-		data.Set("tagCounts", a.client.SubRepoTagCounts(repoPath, repos))
+		data.Set("isCatalogReady", client.IsCatalogReady())
+		data.Set("tagCounts", client.SubRepoTagCounts(repoPath, repos))
 		data.Set("tags", tags)
-		if repoPath != "" && (len(repos) > 0 || len(tags) > 0) {
+		if repoPath != "" && (len(repos) > 0 || len(tags) > 0 || artifactTagCount > 0) {
 			// Do not show events in the root of catalog.
-			data.Set("events", a.eventListener.GetEvents(repoPath))
+			data.Set("events", a.eventListener.GetEvents(client.Name(), repoPath))
 		}
 		return c.Render(http.StatusOK, "catalog.html", data)
 	}
 }
 
+// listRepos return sub-repos of the repo path and whether the path itself is a repo with tags.
+func listRepos(client *registry.Client, repoPath string) ([]string, bool) {
+	isRepo := false
+	repos := []string{}
+	for _, r := range client.GetRepos() {
+		if repoPath == "" {
+			// Show all repos
+			repos = append(repos, strings.Split(r, "/")[0])
+			continue
+		}
+		if r == repoPath {
+			// Show tags
+			isRepo = true
+		}
+		if strings.HasPrefix(r, repoPath+"/") {
+			// Show sub-repos
+			r = strings.TrimPrefix(r, repoPath+"/")
+			repos = append(repos, strings.Split(r, "/")[0])
+		}
+	}
+	return registry.UniqueSortedSlice(repos), isRepo
+}
+
+// imageRepo return repo path of the image reference "repo:tag" or "repo@digest".
+func imageRepo(imageRef string) string {
+	if i := strings.Index(imageRef, "@"); i != -1 {
+		return imageRef[:i]
+	}
+	if i := strings.LastIndex(imageRef, ":"); i != -1 {
+		return imageRef[:i]
+	}
+	return imageRef
+}
+
+// viewCompare compare two images of the repo set by "base" and "target" tags or digests.
+func (a *apiClient) viewCompare(c echo.Context) error {
+	repoPath := strings.Trim(c.Param("repoPath"), "/")
+	base := c.QueryParam("base")
+	target := c.QueryParam("target")
+	client, err := a.getClient(c)
+	if err != nil {
+		return err
+	}
+
+	data := a.setUserPermissions(c)
+	a.setRegistryData(data, client)
+	data.Set("repoPath", repoPath)
+	if base == "" || target == "" {
+		setFlash(c, a.basePath, "danger", "Both images to compare are required.")
+		return c.Redirect(http.StatusSeeOther, fmt.Sprintf("%s/%s", a.registryPath(client), repoPath))
+	}
+	diff, err := client.CompareImages(c.Request().Context(), repoPath, base, target)
+	if err != nil {
+		setFlash(c, a.basePath, "danger", fmt.Sprintf("Cannot compare %s with %s: %s", base, target, err))
+		return c.Redirect(http.StatusSeeOther, fmt.Sprintf("%s/%s", a.registryPath(client), repoPath))
+	}
+	data.Set("base", base)
+	data.Set("target", target)
+	data.Set("diff", diff)
+	return c.Render(http.StatusOK, "compare.html", data)
+}
+
+// viewSBOM show packages of the SBOM attached to the image "digest", the first one unless "artifact" is set.
+func (a *apiClient) viewSBOM(c echo.Context) error {
+	repoPath := strings.Trim(c.Param("repoPath"), "/")
+	digest := c.QueryParam("digest")
+	client, err := a.getClient(c)
+	if err != nil {
+		return err
+	}
+
+	data := a.setUserPermissions(c)
+	a.setRegistryData(data, client)
+	data.Set("repoPath", repoPath)
+	imagePath := fmt.Sprintf("%s/%s@%s", a.registryPath(client), repoPath, digest)
+	referrers, err := client.ListReferrers(c.Request().Context(), repoPath, digest)
+	if err != nil {
+		setFlash(c, a.basePath, "danger", fmt.Sprintf("Cannot list artifacts of %s@%s: %s", repoPath, digest, err))
+		return c.Redirect(http.StatusSeeOther, imagePath)
+	}
+
+	artifact, sbom, err := client.FindSBOM(c.Request().Context(), repoPath, digest, c.QueryParam("artifact"))
+	if err != nil {
+		setFlash(c, a.basePath, "danger", fmt.Sprintf("Cannot read SBOM of %s@%s: %s", repoPath, digest, err))
+		return c.Redirect(http.StatusSeeOther, imagePath)
+	}
+	data.Set("digest", digest)
+	data.Set("artifact", artifact)
+	data.Set("artifacts", registry.SBOMReferrers(referrers))
+	data.Set("sbom", sbom)
+	return c.Render(http.StatusOK, "sbom.html", data)
+}
+
+// viewSearch search repos, tags and labels of the registry by the query "q".
+func (a *apiClient) viewSearch(c echo.Context) error {
+	client, err := a.getClient(c)
+	if err != nil {
+		return err
+	}
+
+	data := a.setUserPermissions(c)
+	a.setRegistryData(data, client)
+	query := strings.TrimSpace(c.QueryParam("q"))
+	data.Set("query", query)
+	data.Set("results", client.Search(query, searchResultsLimit))
+	return c.Render(http.StatusOK, "search.html", data)
+}
+
 func (a *apiClient) deleteTag(c echo.Context) error {
-	repoPath := c.QueryParam("repoPath")
-	tag := c.QueryParam("tag")
+	repoPath := c.FormValue("repoPath")
+	tag := c.FormValue("tag")
+	client, err := a.getClient(c)
+	if err != nil {
+		return err
+	}
+
+	data := a.setUserPermissions(c)
+	if !data["deleteAllowed"].Bool() {
+		setFlash(c, a.basePath, "danger", fmt.Sprintf("User \"%s\" is not permitted to delete tags.", data["user"].String()))
+	} else if c.FormValue("untag") != "" {
+		// Safe untag, keep the other tags pointing to the same image.
+		method, err := client.UntagTag(c.Request().Context(), repoPath, tag)
+		switch {
+		case err != nil:
+			setFlash(c, a.basePath, "danger", fmt.Sprintf("Failed to delete %s:%s: %s", repoPath, tag, err))
+		case method == registry.UntagByPlaceholder:
+			setFlash(c, a.basePath, "warning", fmt.Sprintf("Tag %s:%s has been deleted. The registry does not support deleting tags, "+
+				"so it was re-pointed to a placeholder image which was deleted, its blob is left until garbage collection.", repoPath, tag))
+		default:
+			setFlash(c, a.basePath, "success", fmt.Sprintf("Tag %s:%s has been deleted.", repoPath, tag))
+		}
+	} else if err := client.DeleteTag(c.Request().Context(), repoPath, tag); err != nil {
+		setFlash(c, a.basePath, "danger", fmt.Sprintf("Failed to delete %s:%s: %s", repoPath, tag, err))
+	} else {
+		setFlash(c, a.basePath, "success", fmt.Sprintf("Tag %s:%s has been deleted.", repoPath, tag))
+	}
+	return c.Redirect(http.StatusSeeOther, fmt.Sprintf("%s/%s", a.registryPath(client), repoPath))
+}
+
+// copyImage tag the image of the repo as another tag of the same or another repo, admins only.
+func (a *apiClient) copyImage(c echo.Context) error {
+	repoPath := strings.Trim(c.FormValue("repoPath"), "/")
+	source := c.FormValue("source")
+	targetRepo := strings.Trim(c.FormValue("targetRepo"), "/")
+	if targetRepo == "" {
+		targetRepo = repoPath
+	}
+	tag := strings.TrimSpace(c.FormValue("tag"))
+	client, err := a.getClient(c)
+	if err != nil {
+		return err
+	}
 
+	imageRef := repoPath + ":" + source
+	if strings.HasPrefix(source, "sha256:") {
+		imageRef = repoPath + "@" + source
+	}
 	data := a.setUserPermissions(c)
-	if data["deleteAllowed"].Bool() {
-		a.client.DeleteTag(repoPath, tag)
+	if !data["isAdmin"].Bool() {
+		setFlash(c, a.basePath, "danger", fmt.Sprintf("User \"%s\" is not permitted to tag images.", data["user"].String()))
+	} else if _, err := client.CopyImage(c.Request().Context(), imageRef, targetRepo, tag, c.FormValue("overwrite") == "true"); err != nil {
+		setFlash(c, a.basePath, "danger", fmt.Sprintf("Failed to tag %s as %s:%s: %s", imageRef, targetRepo, tag, err))
+	} else {
+		setFlash(c, a.basePath, "success", fmt.Sprintf("Image %s has been tagged as %s:%s.", imageRef, targetRepo, tag))
+		return c.Redirect(http.StatusSeeOther, fmt.Sprintf("%s/%s:%s", a.registryPath(client), targetRepo, tag))
 	}
-	basePath := viper.GetString("uri_base_path")
-	return c.Redirect(http.StatusSeeOther, fmt.Sprintf("%s%s", basePath, repoPath))
+	return c.Redirect(http.StatusSeeOther, fmt.Sprintf("%s/%s", a.registryPath(client), imageRef))
+}
+
+// getPromotionTargets promotion targets the images of the registry can be promoted to.
+func (a *apiClient) getPromotionTargets(client *registry.Client) []registry.PromotionTarget {
+	targets := []registry.PromotionTarget{}
+	for _, t := range a.promotionTargets {
+		if t.AllowsSource(client.Name()) {
+			targets = append(targets, t)
+		}
+	}
+	return targets
+}
+
+// promoteImage promote the image of the registry to the target by name and record the promotion in the events database.
+func (a *apiClient) promoteImage(ctx context.Context, client *registry.Client, targetName, imageRef, tag, user string) (registry.Promotion, error) {
+	var target *registry.PromotionTarget
+	for _, t := range a.getPromotionTargets(client) {
+		if t.Name == targetName {
+			target = &t
+			break
+		}
+	}
+	if target == nil {
+		return registry.Promotion{}, fmt.Errorf("%w: promotion target %s for registry %s", registry.ErrNotFound, targetName, client.Name())
+	}
+
+	res, err := client.Promote(ctx, a.getClientByName(target.Target), imageRef, tag)
+	row := events.PromotionRow{
+		Target:         target.Name,
+		SourceRegistry: client.Name(),
+		TargetRegistry: target.Target,
+		Repository:     imageRepo(imageRef),
+		Tag:            res.Tag,
+		Digest:         res.Digest,
+		Referrers:      len(res.Referrers),
+		User:           user,
+	}
+	if err != nil {
+		row.Error = err.Error()
+	}
+	if err := a.eventListener.RecordPromotion(row); err != nil {
+		logrus.Errorf("Error recording promotion of %s to %s: %s", imageRef, target.Name, err)
+	}
+	return res, err
+}
+
+// promote promote the image to another registry, admins only.
+func (a *apiClient) promote(c echo.Context) error {
+	repoPath := strings.Trim(c.FormValue("repoPath"), "/")
+	source := c.FormValue("source")
+	target := c.FormValue("target")
+	tag := strings.TrimSpace(c.FormValue("tag"))
+	client, err := a.getClient(c)
+	if err != nil {
+		return err
+	}
+
+	imageRef := repoPath + ":" + source
+	if strings.HasPrefix(source, "sha256:") {
+		imageRef = repoPath + "@" + source
+	}
+	data := a.setUserPermissions(c)
+	if !data["isAdmin"].Bool() {
+		setFlash(c, a.basePath, "danger", fmt.Sprintf("User \"%s\" is not permitted to promote images.", data["user"].String()))
+	} else if res, err := a.promoteImage(c.Request().Context(), client, target, imageRef, tag, data["user"].String()); err != nil {
+		setFlash(c, a.basePath, "danger", fmt.Sprintf("Failed to promote %s to %s: %s", imageRef, target, err))
+	} else {
+		setFlash(c, a.basePath, "success", fmt.Sprintf("Image %s has been promoted to %s with %d referrers.", imageRef, target, len(res.Referrers)))
+	}
+	return c.Redirect(http.StatusSeeOther, fmt.Sprintf("%s/%s", a.registryPath(client), imageRef))
+}
+
+// viewImport upload form of image tarballs, "repo" query param pre-fills the target repo.
+func (a *apiClient) viewImport(c echo.Context) error {
+	client, err := a.getClient(c)
+	if err != nil {
+		return err
+	}
+
+	data := a.setUserPermissions(c)
+	a.setRegistryData(data, client)
+	data.Set("repo", strings.Trim(c.QueryParam("repo"), "/"))
+	return c.Render(http.StatusOK, "import.html", data)
+}
+
+// refresh trigger refresh of the catalog and tag counts of the registry.
+func (a *apiClient) refresh(c echo.Context) error {
+	client, err := a.getClient(c)
+	if err != nil {
+		return err
+	}
+
+	data := a.setUserPermissions(c)
+	if !data["isAdmin"].Bool() {
+		setFlash(c, a.basePath, "danger", fmt.Sprintf("User \"%s\" is not permitted to refresh the catalog.", data["user"].String()))
+	} else if !client.Refresh() {
+		setFlash(c, a.basePath, "warning", "Refresh or tags counting is already running.")
+	} else {
+		setFlash(c, a.basePath, "success", fmt.Sprintf("Refresh of %s catalog and tag counts has been started.", client.Name()))
+	}
+	return c.Redirect(http.StatusSeeOther, a.registryPath(client)+"/")
 }
 
 // viewLog view events from sqlite.
 func (a *apiClient) viewEventLog(c echo.Context) error {
+	client, err := a.getClient(c)
+	if err != nil {
+		return err
+	}
+
 	data := a.setUserPermissions(c)
-	data.Set("events", a.eventListener.GetEvents(""))
+	a.setRegistryData(data, client)
+	data.Set("events", a.eventListener.GetEvents(client.Name(), ""))
+	data.Set("promotions", a.eventListener.GetPromotions(""))
 	return c.Render(http.StatusOK, "event_log.html", data)
 }
 
-// receiveEvents receive events.
+// receiveEvents receive events and update catalog of the registry set by "registry" query param.
 func (a *apiClient) receiveEvents(c echo.Context) error {
-	a.eventListener.ProcessEvents(c.Request())
+	client := a.getClientByName(c.QueryParam("registry"))
+	if client == nil {
+		logrus.Errorf("Events received for unknown registry %q are ignored, check the notification endpoint url", c.QueryParam("registry"))
+		return c.String(http.StatusNotFound, "unknown registry: "+c.QueryParam("registry"))
+	}
+	for _, e := range a.eventListener.ProcessEvents(client.Name(), c.Request()) {
+		client.ApplyEvent(e.Action, e.Repository, e.Tag)
+	}
 	return c.String(http.StatusOK, "OK")
 }